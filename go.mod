@@ -1,6 +1,6 @@
 module github.com/tlhakhan/zfshttpd
 
-go 1.16
+go 1.20
 
 require (
 	github.com/google/uuid v1.2.0
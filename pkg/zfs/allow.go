@@ -0,0 +1,135 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Delegation is a set of permissions delegated with `zfs allow`.
+type Delegation struct {
+	Dataset string   `json:"dataset"` // dataset the permissions are set on, may be an ancestor of the listed dataset
+	Scope   string   `json:"scope"`   // local, descendent, local+descendent, create time or permission sets
+	Kind    string   `json:"kind"`    // user, group, everyone, or empty for create time and permission sets
+	Who     string   `json:"who"`     // user or group name, or permission set name such as @set
+	Perms   []string `json:"perms"`
+}
+
+// Allow delegates the permissions on the dataset and its descendants to the user, e.g. snapshot and clone.
+func (z *Zpool) Allow(dataset, user string, perms []string) error {
+
+	// short circuit to error if name doesn't start with zpool name
+	// a user or permissions starting with - would be read as a flag
+	if len(dataset) == 0 || !validWho(user) || len(perms) == 0 || strings.HasPrefix(perms[0], "-") || !z.owns(dataset) {
+		return errors.Errorf("permissions %q cannot be allowed to %q on dataset %q on zpool %q", perms, user, dataset, z.Name)
+	}
+
+	// zfs allow -u alice snapshot,clone tank/a
+	cmd := command(zfsPath, "allow", "-u", user, strings.Join(perms, ","), dataset)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		return errors.Wrapf(err, "unable to allow %q to %q on %q", perms, user, dataset)
+	}
+
+	return nil
+}
+
+// Unallow removes the permissions delegated to the user on the dataset. All of the user's permissions are removed when perms is empty.
+func (z *Zpool) Unallow(dataset, user string, perms []string) error {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || !validWho(user) || (len(perms) > 0 && strings.HasPrefix(perms[0], "-")) || !z.owns(dataset) {
+		return errors.Errorf("permissions %q cannot be unallowed to %q on dataset %q on zpool %q", perms, user, dataset, z.Name)
+	}
+
+	// zfs unallow -u alice snapshot,clone tank/a
+	args := []string{"unallow", "-u", user}
+	if len(perms) > 0 {
+		args = append(args, strings.Join(perms, ","))
+	}
+	cmd := command(zfsPath, append(args, dataset)...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		return errors.Wrapf(err, "unable to unallow %q to %q on %q", perms, user, dataset)
+	}
+
+	return nil
+}
+
+// validWho checks the user name of `zfs allow -u` is set and can't be read as a flag.
+func validWho(user string) bool {
+	return len(user) > 0 && !strings.HasPrefix(user, "-")
+}
+
+// ListAllowed will return the permissions delegated on the dataset, including those inherited from its ancestors.
+func (z Zpool) ListAllowed(dataset string) (l []Delegation, err error) {
+
+	l = make([]Delegation, 0)
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || !z.owns(dataset) {
+		return l, errors.Errorf("bad request for dataset %q on zpool %q", dataset, z.Name)
+	}
+
+	// zfs allow tank/a
+	cmd := command(zfsPath, "allow", dataset)
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return l, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseAllow(out), nil
+}
+
+// parseAllow parses the output of `zfs allow`, which looks like
+//
+//	---- Permissions on tank/a -------------------------------------------
+//	Permission sets:
+//		@backup clone,snapshot
+//	Local+Descendent permissions:
+//		user alice @backup,mount
+//		everyone mount
+func parseAllow(out []byte) []Delegation {
+
+	l := make([]Delegation, 0)
+	var dataset, scope string
+
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := in.Text()
+
+		switch {
+		// block header
+		case strings.HasPrefix(line, "---- Permissions on "):
+			dataset = strings.Fields(strings.TrimPrefix(line, "---- Permissions on "))[0]
+
+		// section header, e.g. Local+Descendent permissions:
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, "\t"):
+			scope = strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(line, ":"), " permissions"))
+
+		// entry
+		case strings.HasPrefix(line, "\t"):
+			fields := strings.Fields(line)
+			d := Delegation{Dataset: dataset, Scope: scope}
+			switch {
+			case len(fields) == 3 && (fields[0] == "user" || fields[0] == "group"):
+				d.Kind, d.Who, d.Perms = fields[0], fields[1], strings.Split(fields[2], ",")
+			case len(fields) == 2 && fields[0] == "everyone":
+				d.Kind, d.Perms = fields[0], strings.Split(fields[1], ",")
+			case len(fields) == 2:
+				d.Who, d.Perms = fields[0], strings.Split(fields[1], ",")
+			case len(fields) == 1:
+				d.Perms = strings.Split(fields[0], ",")
+			default:
+				continue
+			}
+			l = append(l, d)
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,94 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestAllow(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// allow snapshot and clone to root
+	if err := z.Allow(fs.Name, "root", []string{"snapshot", "clone"}); err != nil {
+		t.Errorf("unable to allow permissions on %q, received %+v", fs.Name, err)
+	}
+
+	l, err := z.ListAllowed(fs.Name)
+	if err != nil {
+		t.Errorf("unable to list permissions on %q, received %+v", fs.Name, err)
+	}
+	found := false
+	for _, d := range l {
+		t.Logf("found delegation on %s, scope: %s, kind: %s, who: %s, perms: %v\n", d.Dataset, d.Scope, d.Kind, d.Who, d.Perms)
+		if d.Dataset == fs.Name && d.Kind == "user" && d.Who == "root" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("delegation to root on %q not found", fs.Name)
+	}
+
+	// remove all permissions of root
+	if err := z.Unallow(fs.Name, "root", nil); err != nil {
+		t.Errorf("unable to unallow permissions on %q, received %+v", fs.Name, err)
+	}
+
+	// empty permissions case
+	if err := z.Allow(fs.Name, "root", nil); err == nil {
+		t.Errorf("allowing no permissions should fail")
+	}
+
+	// bad user cases
+	for _, user := range []string{"", "-d", "--help"} {
+		if err := z.Allow(fs.Name, user, []string{"snapshot"}); err == nil {
+			t.Errorf("allowing permissions to user %q should fail", user)
+		}
+		if err := z.Unallow(fs.Name, user, nil); err == nil {
+			t.Errorf("unallowing permissions of user %q should fail", user)
+		}
+	}
+}
+
+func TestParseAllow(t *testing.T) {
+
+	out := []byte("---- Permissions on tank/a -------------------------------------------\n" +
+		"Permission sets:\n" +
+		"\t@backup clone,snapshot\n" +
+		"Create time permissions:\n" +
+		"\tdestroy\n" +
+		"Local+Descendent permissions:\n" +
+		"\tuser alice @backup,mount\n" +
+		"\teveryone mount\n" +
+		"---- Permissions on tank ---------------------------------------------\n" +
+		"Local permissions:\n" +
+		"\tgroup staff create\n")
+
+	l := parseAllow(out)
+	if len(l) != 5 {
+		t.Errorf("expected 5 delegations, found %d", len(l))
+		return
+	}
+
+	expected := []Delegation{
+		{Dataset: "tank/a", Scope: "permission sets", Who: "@backup"},
+		{Dataset: "tank/a", Scope: "create time"},
+		{Dataset: "tank/a", Scope: "local+descendent", Kind: "user", Who: "alice"},
+		{Dataset: "tank/a", Scope: "local+descendent", Kind: "everyone"},
+		{Dataset: "tank", Scope: "local", Kind: "group", Who: "staff"},
+	}
+	for i, e := range expected {
+		if l[i].Dataset != e.Dataset || l[i].Scope != e.Scope || l[i].Kind != e.Kind || l[i].Who != e.Who {
+			t.Errorf("delegation %d is %+v, expected %+v", i, l[i], e)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type Bookmark struct {
+	Name      string `json:"name"`
+	GUID      string `json:"guid"`
+	CreateTxg int64  `json:"createtxg"`
+}
+
+type Bookmarks map[string]*Bookmark
+
+// setProperty sets the field of the bookmark matching the zfs property.
+func (b *Bookmark) setProperty(property, value string) (err error) {
+	switch property {
+	case "name":
+		b.Name = value
+	case "guid":
+		b.GUID = value
+	case "createtxg":
+		b.CreateTxg, err = parseInt(property, value)
+	}
+	return err
+}
+
+// isBookmarkName checks the name is in the form filesystem#bookmark.
+func isBookmarkName(name string) bool {
+	i := strings.Index(name, "#")
+	return i > 0 && i < len(name)-1 && !strings.Contains(name, "@") && strings.Count(name, "#") == 1
+}
+
+// CreateBookmark creates a bookmark of the snapshot, the bookmark name is in the form filesystem#bookmark.
+func (z *Zpool) CreateBookmark(snapshot, bookmark string) (b Bookmark, err error) {
+
+	// short circuit to error if names don't belong to the zpool
+	if !z.owns(snapshot) || !strings.Contains(snapshot, "@") {
+		return b, errors.Errorf("bad snapshot %q on zpool %q", snapshot, z.Name)
+	}
+	if !z.owns(bookmark) || !isBookmarkName(bookmark) {
+		return b, errors.Errorf("bookmark %q cannot be created on zpool %q", bookmark, z.Name)
+	}
+
+	// build command
+	cmd := command(zfsPath, "bookmark", snapshot, bookmark)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. bookmark already exists
+		// 2. snapshot doesn't exist
+		// 3. bookmark and snapshot are on different filesystems
+		return b, errors.Wrapf(err, "unable to create bookmark %q of snapshot %q", bookmark, snapshot)
+	}
+
+	// retrieve the newly created bookmark
+	b, err = z.GetBookmark(bookmark)
+	if err != nil {
+		return b, errors.Wrapf(err, "unable to retrieve bookmark %q after creation", bookmark)
+	}
+
+	return b, nil
+}
+
+// GetBookmark will return the found Bookmark
+func (z Zpool) GetBookmark(name string) (b Bookmark, err error) {
+
+	// bookmark name should start with zpool name
+	if !z.owns(name) || !isBookmarkName(name) {
+		return b, errors.Errorf("bad request for bookmark %q on zpool %q", name, z.Name)
+	}
+
+	// zfs get -t bookmark -Hpo property,value name,guid,createtxg tank/fs#mark
+	cmd := command(zfsPath, "get", "-t", "bookmark", "-Hpo", "property,value", "name,guid,createtxg", name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		return b, errors.Wrapf(err, "bookmark %q not found", name)
+	}
+
+	// parse []byte output
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		fields, err := splitFields(in.Text(), 2)
+		if err != nil {
+			return b, err
+		}
+		if err := b.setProperty(fields[0], fields[1]); err != nil {
+			return b, err
+		}
+	}
+
+	return b, nil
+}
+
+// ListBookmarks will return a map of bookmarks on the zpool
+func (z Zpool) ListBookmarks() (l Bookmarks, err error) {
+
+	// make map
+	l = make(Bookmarks, 0)
+
+	//  zfs get -t bookmark -Hpro name,property,value guid,createtxg tank
+	props, names, err := z.getProperties([]string{"-t", "bookmark", "-r"}, "guid,createtxg", z.Name)
+	if err != nil {
+		return l, err
+	}
+
+	for _, name := range names {
+		b := &Bookmark{Name: name}
+		for property, value := range props[name] {
+			if err := b.setProperty(property, value); err != nil {
+				return l, err
+			}
+		}
+		l[name] = b
+	}
+	return l, nil
+}
+
+// DestroyBookmark destroys the bookmark, the name is in the form filesystem#bookmark.
+func (z *Zpool) DestroyBookmark(name string) error {
+
+	// short circuit to error if name isn't a bookmark of the zpool
+	if !z.owns(name) || !isBookmarkName(name) {
+		return errors.Errorf("bookmark %q cannot be destroyed on zpool %q", name, z.Name)
+	}
+
+	// known ways to fail
+	// 1. bookmark doesn't exist
+	// 2. zfs fails
+	return z.destroy(name)
+}
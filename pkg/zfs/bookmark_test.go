@@ -0,0 +1,72 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q, received %+v", fs.Name, err)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// create a bookmark of the snapshot
+	bookmarkName := fmt.Sprintf("%s#new_mark_%s", fs.Name, uuid.New())
+	b, err := z.CreateBookmark(snap.Name, bookmarkName)
+	if err != nil {
+		t.Errorf("failed to create new bookmark %q, received %+v", bookmarkName, err)
+	} else {
+		t.Logf("created new bookmark %s, guid: %s, createtxg: %d\n", b.Name, b.GUID, b.CreateTxg)
+		if b.GUID != snap.GUID {
+			t.Errorf("bookmark %q guid %s doesn't match snapshot guid %s", b.Name, b.GUID, snap.GUID)
+		}
+	}
+
+	// bookmark is listed
+	l, err := z.ListBookmarks()
+	if err != nil {
+		t.Errorf("unable to get bookmarks on %s, received %+v", z.Name, err)
+	} else if _, ok := l[bookmarkName]; !ok {
+		t.Errorf("bookmark %q not found in listing", bookmarkName)
+	}
+
+	// destroying a bookmark as a snapshot case
+	if err := z.DestroySnapshot(bookmarkName); err == nil {
+		t.Errorf("destroying bookmark %q as a snapshot should fail", bookmarkName)
+	}
+
+	// destroying a snapshot as a bookmark case
+	if err := z.DestroyBookmark(snap.Name); err == nil {
+		t.Errorf("destroying snapshot %q as a bookmark should fail", snap.Name)
+	}
+
+	// destroy the bookmark
+	if err := z.DestroyBookmark(bookmarkName); err != nil {
+		t.Errorf("failed to destroy bookmark %q, received %+v", bookmarkName, err)
+	}
+
+	// the snapshot is still there
+	if !z.SnapshotExists(snap.Name) {
+		t.Errorf("snapshot %q should still exist", snap.Name)
+	}
+
+	// destroy the snapshot
+	if err := z.DestroySnapshot(snap.Name); err != nil {
+		t.Errorf("failed to destroy snapshot %q, received %+v", snap.Name, err)
+	}
+}
@@ -0,0 +1,119 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// Change is a file changed between two snapshots, from `zfs diff`.
+type Change struct {
+	Type    string `json:"type"`              // + added, - removed, M modified, R renamed
+	Path    string `json:"path"`              // path of the file, its old path when renamed
+	NewPath string `json:"newPath,omitempty"` // path of a renamed file
+}
+
+// Diff returns the files changed between the fromSnap snapshot and toSnap, a later snapshot of the same filesystem
+// or the filesystem itself for the changes since fromSnap.
+func (z Zpool) Diff(fromSnap, toSnap string) ([]Change, error) {
+
+	// snapshot names should start with zpool name
+	if !strings.Contains(fromSnap, "@") || !z.owns(fromSnap) || len(toSnap) == 0 || !z.owns(toSnap) {
+		return nil, errors.Errorf("bad request for diff of %q and %q on zpool %q", fromSnap, toSnap, z.Name)
+	}
+
+	// zfs diff -H tank/a@snap1 tank/a@snap2
+	cmd := command(zfsPath, "diff", "-H", fromSnap, toSnap)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		// known ways to fail
+		// 1. snapshot doesn't exist
+		// 2. snapshots aren't of the same filesystem, or fromSnap is the later one
+		// 3. missing diff permission
+		cmdString := getCommandString(cmd)
+		return nil, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseDiff(out)
+}
+
+// DiffSummary returns the number of files added, modified, removed and renamed between the snapshots, see Diff.
+func (z Zpool) DiffSummary(fromSnap, toSnap string) (added, modified, removed, renamed int, err error) {
+
+	changes, err := z.Diff(fromSnap, toSnap)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	for _, c := range changes {
+		switch c.Type {
+		case "+":
+			added++
+		case "M":
+			modified++
+		case "-":
+			removed++
+		case "R":
+			renamed++
+		}
+	}
+
+	return added, modified, removed, renamed, nil
+}
+
+// parseDiff parses `zfs diff -H` output, a tab separated change type and path per line followed by the new path
+// of a rename.
+func parseDiff(out []byte) ([]Change, error) {
+
+	// zfs diff -H example
+	// M	/tank/a/
+	// +	/tank/a/new\0040file
+	// R	/tank/a/old	/tank/a/renamed
+	changes := make([]Change, 0)
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := in.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || len(fields) > 3 || (fields[0] == "R") != (len(fields) == 3) {
+			return changes, errors.Errorf("unable to parse zfs diff line %q", line)
+		}
+		switch fields[0] {
+		case "+", "-", "M", "R":
+		default:
+			return changes, errors.Errorf("unknown change type in zfs diff line %q", line)
+		}
+
+		c := Change{Type: fields[0], Path: unescapeDiffPath(fields[1])}
+		if len(fields) == 3 {
+			c.NewPath = unescapeDiffPath(fields[2])
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// unescapeDiffPath decodes the \NNNN octal escapes zfs diff uses for spaces and unprintable bytes in paths.
+func unescapeDiffPath(p string) string {
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+4 < len(p) {
+			if n, err := strconv.ParseUint(p[i+1:i+5], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 4
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
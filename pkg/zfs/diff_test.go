@@ -0,0 +1,79 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+
+	out := "M\t/tank/a/\n" +
+		"+\t/tank/a/new\\0040file\n" +
+		"-\t/tank/a/gone\n" +
+		"R\t/tank/a/old\t/tank/a/renamed\n"
+
+	changes, err := parseDiff([]byte(out))
+	if err != nil {
+		t.Errorf("unable to parse diff, received %+v", err)
+	} else if len(changes) != 4 {
+		t.Errorf("parsed %d changes, expected 4: %+v", len(changes), changes)
+	} else {
+		if c := changes[1]; c.Type != "+" || c.Path != "/tank/a/new file" {
+			t.Errorf("parsed added change %+v", c)
+		}
+		if c := changes[3]; c.Type != "R" || c.Path != "/tank/a/old" || c.NewPath != "/tank/a/renamed" {
+			t.Errorf("parsed renamed change %+v", c)
+		}
+	}
+
+	// badly shaped lines
+	for _, line := range []string{"M /tank/a", "X\t/tank/a", "R\t/tank/a", "+\t/tank/a\t/tank/b"} {
+		if _, err := parseDiff([]byte(line + "\n")); err == nil {
+			t.Errorf("parsing diff line %q should fail", line)
+		}
+	}
+}
+
+func TestDiffSummary(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// add a file between two snapshots
+	from, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	if err := os.WriteFile(filepath.Join(fs.Mountpoint, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Errorf("unable to write file to %q, received %+v", fs.Mountpoint, err)
+	}
+	to, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+
+	added, modified, removed, renamed, err := z.DiffSummary(from.Name, to.Name)
+	if err != nil {
+		t.Errorf("unable to diff %q and %q, received %+v", from.Name, to.Name, err)
+	} else {
+		t.Logf("diff of %s and %s: %d added, %d modified, %d removed, %d renamed", from.Name, to.Name, added, modified, removed, renamed)
+		if added != 1 {
+			t.Errorf("diff of %q and %q should have 1 added file, found %d", from.Name, to.Name, added)
+		}
+	}
+
+	// filesystem as the from snapshot case
+	if _, _, _, _, err := z.DiffSummary(fs.Name, to.Name); err == nil {
+		t.Errorf("diff from filesystem %q should fail", fs.Name)
+	}
+}
@@ -0,0 +1,95 @@
+package zfs
+
+import (
+	"bufio"
+	"context"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Event is an event from the zfs event daemon, such as a scrub finishing or a device being removed.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Class string    `json:"class"` // e.g. sysevent.fs.zfs.scrub_finish
+}
+
+// eventTimeLayout is the time format of `zpool events`.
+const eventTimeLayout = "Jan 02 2006 15:04:05.000000000"
+
+// Events runs `zpool events -f` and delivers each event of the zpool on the returned channel.
+// Events already in the event log are delivered first. The command is killed and the channel is closed when the context
+// is done or the zpool is closed.
+func (z Zpool) Events(ctx context.Context) (<-chan Event, error) {
+
+	// stop when the zpool is closed
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-z.closed():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// zpool events -Hf tank
+	cmd := commandContext(ctx, zpoolPath, "events", "-Hf", z.Name)
+	cmd.Env = z.environ()
+	cmdString := getCommandString(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		// reap the command once its output ends, which happens when the context kills it
+		defer func() {
+			cmd.Wait()
+			logCommand(cmd, time.Since(start))
+		}()
+
+		in := bufio.NewScanner(stdout)
+		for in.Scan() {
+			e, err := parseEvent(in.Text())
+			if err != nil {
+				continue
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// parseEvent parses a line of `zpool events -H` output, the time and class separated by a tab.
+func parseEvent(line string) (e Event, err error) {
+
+	fields := strings.Split(strings.TrimSpace(line), "\t")
+	if len(fields) != 2 {
+		return e, errors.Errorf("unable to parse zpool event %q", line)
+	}
+
+	e.Time, err = time.ParseInLocation(eventTimeLayout, strings.TrimSpace(fields[0]), time.Local)
+	if err != nil {
+		return e, errors.Wrapf(err, "unable to parse zpool event time %q", fields[0])
+	}
+	e.Class = strings.TrimSpace(fields[1])
+
+	return e, nil
+}
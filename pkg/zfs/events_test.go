@@ -0,0 +1,105 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	needsZpool(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := z.Events(ctx)
+	if err != nil {
+		t.Errorf("unable to get events of %s, received %+v", z.Name, err)
+		cancel()
+		return
+	}
+
+	// creating a filesystem logs a history event
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	if _, err := z.CreateFilesystem(fs); err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	select {
+	case e := <-events:
+		t.Logf("found event %s at %s\n", e.Class, e.Time)
+	case <-time.After(10 * time.Second):
+		t.Errorf("no event of %s received within timeout", z.Name)
+	}
+
+	// the channel is closed once the context is cancelled
+	cancel()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Errorf("events channel of %s not closed within timeout", z.Name)
+			return
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+
+	e, err := parseEvent("Oct 12 2021 09:55:20.137012345\tsysevent.fs.zfs.config_sync\n")
+	if err != nil {
+		t.Errorf("unable to parse event, received %+v", err)
+	} else if e.Class != "sysevent.fs.zfs.config_sync" || e.Time.Year() != 2021 || e.Time.Nanosecond() != 137012345 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// bad line case
+	if _, err := parseEvent("TIME CLASS"); err == nil {
+		t.Errorf("parsing a header line should fail")
+	}
+}
+
+func TestClose(t *testing.T) {
+	needsZpool(t)
+
+	// a separate handle so closing it doesn't affect other tests
+	handle, err := New(z.Name)
+	if err != nil {
+		t.Errorf("unable to get zpool %s, received %+v", z.Name, err)
+		return
+	}
+
+	events, err := handle.Events(context.Background())
+	if err != nil {
+		t.Errorf("unable to get events of %s, received %+v", z.Name, err)
+		return
+	}
+
+	// closing stops the events watcher, and can be repeated
+	for i := 0; i < 2; i++ {
+		if err := handle.Close(); err != nil {
+			t.Errorf("unable to close zpool %s, received %+v", z.Name, err)
+		}
+	}
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				// a zpool without background work can be closed too
+				bare := Zpool{Name: z.Name}
+				if err := bare.Close(); err != nil {
+					t.Errorf("unable to close bare zpool %s, received %+v", z.Name, err)
+				}
+				return
+			}
+		case <-timeout:
+			t.Errorf("events channel of %s not closed within timeout", z.Name)
+			return
+		}
+	}
+}
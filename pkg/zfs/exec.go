@@ -0,0 +1,158 @@
+package zfs
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// debugLogger logs every command executed by the package, nil disables command logging.
+var debugLogger *log.Logger
+
+// SetDebugLogger sets the logger used to log every zfs and zpool command executed by the package, with its duration and exit status.
+// Passing nil disables command logging, which is the default. It should be called before the package is used.
+func SetDebugLogger(l *log.Logger) {
+	debugLogger = l
+}
+
+// privilegeWrapper is the command prepended to every zfs and zpool command, e.g. sudo -n, empty runs them directly.
+var privilegeWrapper []string
+
+// SetPrivilegeWrapper sets a command prepended to every zfs and zpool command, such as "sudo", "-n" or "doas", so the
+// caller can run unprivileged. Calling it without arguments runs the commands directly, which is the default.
+// It should be called before the package is used, the pre-flight checks run without it.
+func SetPrivilegeWrapper(wrapper ...string) {
+	privilegeWrapper = append([]string{}, wrapper...)
+}
+
+// command returns the command to run the named zfs or zpool binary with the args, prefixed by the privilege wrapper.
+// The command runs with LC_ALL=C so its output isn't localized.
+func command(name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if len(privilegeWrapper) == 0 {
+		cmd = exec.Command(name, args...)
+	} else {
+		cmd = exec.Command(privilegeWrapper[0], wrapArgs(name, args)...)
+	}
+	cmd.Env = defaultEnviron()
+	return cmd
+}
+
+// commandContext is command with a context that kills the command when done.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if len(privilegeWrapper) == 0 {
+		cmd = exec.CommandContext(ctx, name, args...)
+	} else {
+		cmd = exec.CommandContext(ctx, privilegeWrapper[0], wrapArgs(name, args)...)
+	}
+	cmd.Env = defaultEnviron()
+	return cmd
+}
+
+// defaultEnviron returns the process environment with LC_ALL=C, which overrides any LC_ALL already set.
+// The parsers expect the C locale's number and date formats.
+func defaultEnviron() []string {
+	return append(os.Environ(), "LC_ALL=C")
+}
+
+// wrapArgs returns the privilege wrapper's args followed by the name and args of the wrapped command.
+func wrapArgs(name string, args []string) []string {
+	wrapped := append([]string{}, privilegeWrapper[1:]...)
+	return append(append(wrapped, name), args...)
+}
+
+// execAndLog runs the command, returns its standard output and logs it to the debug logger.
+func execAndLog(cmd *exec.Cmd) ([]byte, error) {
+	start := time.Now()
+	out, err := cmd.Output()
+	logCommand(cmd, time.Since(start))
+	return out, err
+}
+
+// logCommand logs the command string, duration and exit status of a finished command to the debug logger.
+func logCommand(cmd *exec.Cmd, duration time.Duration) {
+	if debugLogger == nil {
+		return
+	}
+
+	// exit status is -1 when the command didn't start or was killed by a signal
+	status := -1
+	if cmd.ProcessState != nil {
+		status = cmd.ProcessState.ExitCode()
+	}
+
+	debugLogger.Printf("%s: duration %s, exit status %d", getCommandString(cmd), duration, status)
+}
+
+// WithEnv returns a copy of the zpool whose zfs and zpool commands run with the environment variables added to the
+// process environment. LC_ALL defaults to C so the output parsed by the package isn't localized, env can override it.
+func (z Zpool) WithEnv(env map[string]string) Zpool {
+	z.env = make(map[string]string, len(env))
+	for k, v := range env {
+		z.env[k] = v
+	}
+	return z
+}
+
+// environ returns the environment of the zpool's commands, the process environment with LC_ALL=C and the WithEnv variables.
+func (z Zpool) environ() []string {
+	env := defaultEnviron()
+
+	// sorted so the later duplicate wins consistently, exec keeps the last value of a duplicate key
+	keys := make([]string, 0, len(z.env))
+	for k := range z.env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+z.env[k])
+	}
+	return env
+}
+
+// Runner runs a zfs or zpool command and returns its standard output, like (*exec.Cmd).Output.
+// A failed command's error should be an *exec.ExitError with Stderr set, as the package inspects it.
+type Runner interface {
+	Run(cmd *exec.Cmd) ([]byte, error)
+}
+
+// execRunner runs commands on the host, it is the default Runner.
+type execRunner struct{}
+
+// Run runs the command and logs it to the debug logger.
+func (execRunner) Run(cmd *exec.Cmd) ([]byte, error) {
+	return execAndLog(cmd)
+}
+
+// runner returns the Runner of the zpool, the host when none is set.
+func (z Zpool) runner() Runner {
+	if z.Runner == nil {
+		return execRunner{}
+	}
+	return z.Runner
+}
+
+// run runs the command with the runner and timeout of the zpool and returns its standard output.
+func (z Zpool) run(cmd *exec.Cmd) ([]byte, error) {
+	cmd.Env = z.environ()
+	if z.Timeout <= 0 {
+		return z.runner().Run(cmd)
+	}
+
+	// rebuild the command so it is killed when the timeout expires
+	ctx, cancel := context.WithTimeout(context.Background(), z.Timeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	c.Env, c.Dir, c.Stdin, c.Stderr = cmd.Env, cmd.Dir, cmd.Stdin, cmd.Stderr
+
+	out, err := z.runner().Run(c)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return out, errors.Wrapf(ctx.Err(), "command %q timed out after %s", getCommandString(c), z.Timeout)
+	}
+	return out, err
+}
@@ -0,0 +1,221 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetDebugLogger(t *testing.T) {
+	needsZpool(t)
+
+	var buf bytes.Buffer
+	SetDebugLogger(log.New(&buf, "", 0))
+	defer SetDebugLogger(nil)
+
+	// run a command and check it was logged
+	if _, err := z.ExistsByName(z.Name); err != nil {
+		t.Errorf("unable to check if %q exists, received %+v", z.Name, err)
+	}
+
+	if !strings.Contains(buf.String(), "zfs list") || !strings.Contains(buf.String(), "exit status 0") {
+		t.Errorf("command was not logged, found %q", buf.String())
+	} else {
+		t.Logf("logged %q", strings.TrimSpace(buf.String()))
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	needsZpool(t)
+
+	// a timeout that can't be met
+	short := z
+	short.Timeout = time.Nanosecond
+	if _, err := short.ListFilesystems(); errors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("listing filesystems with %s timeout should fail with %v, received %+v", short.Timeout, context.DeadlineExceeded, err)
+	}
+
+	// a generous timeout
+	long := z
+	long.Timeout = 30 * time.Second
+	if _, err := long.ListFilesystems(); err != nil {
+		t.Errorf("unable to list filesystems with %s timeout, received %+v", long.Timeout, err)
+	}
+}
+
+func TestSetPrivilegeWrapper(t *testing.T) {
+	needsZpool(t)
+
+	var buf bytes.Buffer
+	SetDebugLogger(log.New(&buf, "", 0))
+	defer SetDebugLogger(nil)
+
+	// env runs the wrapped command unchanged
+	SetPrivilegeWrapper("env", "LC_ALL=C")
+	defer SetPrivilegeWrapper()
+
+	if _, err := z.ExistsByName(z.Name); err != nil {
+		t.Errorf("unable to check if %q exists with a privilege wrapper, received %+v", z.Name, err)
+	}
+
+	// the logged command shows the wrapper
+	if !strings.Contains(buf.String(), "env LC_ALL=C "+zfsPath+" list") {
+		t.Errorf("wrapped command was not logged, found %q", buf.String())
+	} else {
+		t.Logf("logged %q", strings.TrimSpace(buf.String()))
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	needsZpool(t)
+
+	env := map[string]string{"ZFS_COLOR": "0"}
+	withEnv := z.WithEnv(env)
+
+	// the environment defaults to LC_ALL=C and includes the added variables
+	environ := strings.Join(withEnv.environ(), "\n")
+	if !strings.Contains(environ, "\nLC_ALL=C\n") || !strings.Contains(environ, "\nZFS_COLOR=0") {
+		t.Errorf("environment is missing LC_ALL=C or ZFS_COLOR=0")
+	}
+
+	// the original zpool and the given map are untouched
+	env["ZFS_COLOR"] = "1"
+	if len(z.env) != 0 || withEnv.env["ZFS_COLOR"] != "0" {
+		t.Errorf("WithEnv should copy the environment into a new zpool")
+	}
+
+	// commands run with the environment
+	if _, err := withEnv.ListFilesystems(); err != nil {
+		t.Errorf("unable to list filesystems with environment, received %+v", err)
+	}
+}
+
+func TestNonCLocale(t *testing.T) {
+	needsZpool(t)
+
+	// a locale with comma decimal separators and localized dates
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+
+	// LC_ALL=C is set after the process environment, so it wins
+	env := defaultEnviron()
+	if env[len(env)-1] != "LC_ALL=C" {
+		t.Errorf("LC_ALL=C should be last in the environment, found %q", env[len(env)-1])
+	}
+
+	// parsing still works
+	if _, err := z.Capacity(); err != nil {
+		t.Errorf("unable to get capacity of %s under a non-C locale, received %+v", z.Name, err)
+	}
+	if _, err := z.ListFilesystemsSorted("used", true); err != nil {
+		t.Errorf("unable to list sorted filesystems under a non-C locale, received %+v", err)
+	}
+	if _, err := Version(); err != nil {
+		t.Errorf("unable to get zfs version under a non-C locale, received %+v", err)
+	}
+}
+
+// fakeRunner returns canned output for commands, matched by the command string.
+type fakeRunner map[string]string
+
+func (f fakeRunner) Run(cmd *exec.Cmd) ([]byte, error) {
+	out, ok := f[getCommandString(cmd)]
+	if !ok {
+		return nil, errors.Errorf("unexpected command %q", getCommandString(cmd))
+	}
+	return []byte(out), nil
+}
+
+// countingRunner counts the commands it runs by command string, running them with the fake runner.
+type countingRunner struct {
+	fake  fakeRunner
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (c *countingRunner) Run(cmd *exec.Cmd) ([]byte, error) {
+	c.mu.Lock()
+	c.count[getCommandString(cmd)]++
+	c.mu.Unlock()
+	return c.fake.Run(cmd)
+}
+
+func TestRunner(t *testing.T) {
+
+	fake := Zpool{Name: "tank", Runner: fakeRunner{
+		"zfs version": "zfs-2.2.6-1\nzfs-kmod-2.2.6-1\n",
+		"zfs list -Ho name -t filesystem -r tank":                       "tank\ntank/b\ntank/a\n",
+		"zpool list -Hp -o size,alloc,free,capacity,fragmentation tank": "1000\t400\t600\t40\t5\n",
+		"zfs get -Hpo name,property,value -t filesystem -r " + strings.Join(filesystemProperties, ",") + " tank": "" +
+			"tank\tname\ttank\ntank\torigin\t-\ntank\tguid\t11\ntank\tcreatetxg\t1\ntank\tmountpoint\t/tank\n" +
+			"tank/a\tname\ttank/a\ntank/a\torigin\ttank@s1\ntank/a\tguid\t12\ntank/a\tcreatetxg\t30\ntank/a\tmountpoint\t/tank/a\n" +
+			"tank/a\tusedbydataset\t4096\ntank/a\tquota\t1073741824\ntank/a\tcompressratio\t1.50\n",
+		"zfs get -Hpo name,property,value -t snapshot -s " + snapshotSources + " -r guid,createtxg,creation," + commentProperty + " tank": "" +
+			"tank@s1\tguid\t21\ntank@s1\tcreatetxg\t20\ntank@s1\tcreation\t1700000000\ntank@s1\t" + commentProperty + "\tnightly backup\n" +
+			"tank/a@s2\tguid\t22\ntank/a@s2\tcreatetxg\t40\ntank/a@s2\tcreation\t1700000100\n",
+	}}
+
+	// filesystem names are parsed and sorted
+	if names, err := fake.ListFilesystemNames(); err != nil || strings.Join(names, ",") != "tank,tank/a,tank/b" {
+		t.Errorf("parsed filesystem names %v, received %+v", names, err)
+	}
+
+	// capacity is parsed
+	if c, err := fake.Capacity(); err != nil || c != (PoolCapacity{Size: 1000, Allocated: 400, Free: 600, Capacity: 40, Fragmentation: 5}) {
+		t.Errorf("parsed capacity %+v, received %+v", c, err)
+	}
+
+	// filesystems are parsed
+	if l, err := fake.ListFilesystems(); err != nil || len(l) != 2 {
+		t.Errorf("parsed filesystems %v, received %+v", l, err)
+	} else if a := l["tank/a"]; a == nil || a.GUID != "12" || a.Origin != "tank@s1" || a.CreateTxg != 30 || a.Mountpoint != "/tank/a" ||
+		a.UsedByDataset != 4096 || a.Quota != 1073741824 || a.CompressRatio != 1.5 {
+		t.Errorf("parsed filesystem tank/a %+v", a)
+	}
+
+	// snapshots are parsed
+	if l, err := fake.ListSnapshots(); err != nil || len(l) != 2 {
+		t.Errorf("parsed snapshots %v, received %+v", l, err)
+	} else {
+		if s := l["tank@s1"]; s == nil || s.GUID != "21" || s.CreateTxg != 20 || s.Creation.Unix() != 1700000000 || s.Comment != "nightly backup" {
+			t.Errorf("parsed snapshot tank@s1 %+v", s)
+		}
+		if s := l["tank/a@s2"]; s == nil || s.GUID != "22" || s.CreateTxg != 40 || len(s.Comment) != 0 {
+			t.Errorf("parsed snapshot tank/a@s2 %+v", s)
+		}
+	}
+
+	// failed commands are reported
+	if _, err := (Zpool{Name: "tank", Runner: fakeRunner{}}).ListSnapshots(); err == nil {
+		t.Errorf("listing snapshots without canned output should fail")
+	}
+
+	// JSON output support is detected with the runner, not the host
+	if (Zpool{Name: "tank", Runner: fakeRunner{}}).supportsJSON() {
+		t.Errorf("zpool without a canned version should not use JSON output")
+	}
+	for version, expected := range map[string]bool{"zfs-2.2.6-1\nzfs-kmod-2.2.6-1\n": false, "zfs-2.3.0-1\nzfs-kmod-2.3.0-1\n": true} {
+		versioned := Zpool{Name: "tank", Runner: fakeRunner{"zfs version": version}}
+		if versioned.supportsJSON() != expected {
+			t.Errorf("zpool with version %q should use JSON output: %t", version, expected)
+		}
+	}
+
+	// JSON output support of a zpool without New is detected once per runner
+	counting := &countingRunner{fake: fake.Runner.(fakeRunner), count: map[string]int{}}
+	stateless := Zpool{Name: "tank", Runner: counting}
+	for i := 0; i < 3; i++ {
+		if _, err := stateless.ListSnapshots(); err != nil {
+			t.Errorf("unable to list snapshots with counting runner, received %+v", err)
+		}
+	}
+	if n := counting.count["zfs version"]; n != 1 {
+		t.Errorf("zfs version ran %d times for 3 listings, expected once", n)
+	}
+}
@@ -0,0 +1,67 @@
+package zfs
+
+import (
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileSystem returns a read-only http.FileSystem rooted at the mountpoint of the filesystem, to serve its contents
+// with http.FileServer. The filesystem must be mounted, such as a clone from CloneAndMount.
+func (z Zpool) FileSystem(name string) (http.FileSystem, error) {
+
+	// filesystem name should start with zpool name
+	if len(name) == 0 || !z.owns(name) || strings.ContainsAny(name, "@#") {
+		return nil, errors.Errorf("bad request for filesystem %q on zpool %q", name, z.Name)
+	}
+
+	// zfs get -t filesystem -Ho value mounted,mountpoint tank/a
+	cmd := command(zfsPath, "get", "-t", "filesystem", "-Ho", "value", "mounted,mountpoint", name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filesystem %q not found", name)
+	}
+
+	// one value per line in the order of the properties
+	values := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(values) != 2 {
+		return nil, errors.Errorf("unable to parse zfs get output %q", out)
+	}
+	mounted, mountpoint := values[0], values[1]
+
+	if mounted != "yes" || !strings.HasPrefix(mountpoint, "/") {
+		return nil, errors.Errorf("filesystem %q is not mounted", name)
+	}
+
+	root, err := filepath.EvalSymlinks(mountpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to resolve mountpoint %q of filesystem %q", mountpoint, name)
+	}
+
+	return mountDir(root), nil
+}
+
+// mountDir is an http.FileSystem like http.Dir that only opens files for reading, which doesn't follow symlinks
+// out of the mountpoint. The root is the mountpoint with its own symlinks resolved.
+type mountDir string
+
+// Open resolves the symlinks of the path and opens it when it is still under the mountpoint.
+// A path leading out of the mountpoint is a permission error, which http.FileServer reports as forbidden.
+func (d mountDir) Open(name string) (http.File, error) {
+
+	root := string(d)
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return nil, err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+
+	return os.Open(resolved)
+}
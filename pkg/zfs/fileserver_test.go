@@ -0,0 +1,81 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSystem(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a file
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	if err := os.WriteFile(filepath.Join(fs.Mountpoint, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Errorf("unable to write file on %q, received %+v", fs.Name, err)
+	}
+	// symlink leading out of the mountpoint
+	if err := os.Symlink("/etc/hostname", filepath.Join(fs.Mountpoint, "outside")); err != nil {
+		t.Errorf("unable to create symlink on %q, received %+v", fs.Name, err)
+	}
+
+	// clone and mount a snapshot of it
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	id := uuid.New()
+	clone, err := z.CloneAndMount(snap.Name, fmt.Sprintf("%s/new_clonefs_%s", z.Name, id), fmt.Sprintf("/tmp/new_clonefs_%s", id))
+	if err != nil {
+		t.Errorf("failed to clone and mount %q, received %+v", snap.Name, err)
+	}
+
+	// serve the clone's contents
+	root, err := z.FileSystem(clone.Name)
+	if err != nil {
+		t.Errorf("unable to get file system of %q, received %+v", clone.Name, err)
+		return
+	}
+	srv := httptest.NewServer(http.FileServer(root))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/hello.txt")
+	if err != nil {
+		t.Errorf("unable to get hello.txt from %q, received %+v", clone.Name, err)
+		return
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" {
+		t.Errorf("served hello.txt is %q, expected %q", body, "hello")
+	}
+
+	// symlink out of the mountpoint case
+	resp, err = http.Get(srv.URL + "/outside")
+	if err != nil {
+		t.Errorf("unable to get outside from %q, received %+v", clone.Name, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Errorf("symlink out of the mountpoint of %q should not be served", clone.Name)
+	}
+
+	// unmounted filesystem case
+	if _, err := execAndLog(command(zfsPath, "unmount", fs.Name)); err != nil {
+		t.Errorf("unable to unmount %q, received %+v", fs.Name, err)
+	}
+	if _, err := z.FileSystem(fs.Name); err == nil {
+		t.Errorf("file system of unmounted filesystem %q should fail", fs.Name)
+	}
+}
@@ -2,76 +2,119 @@ package zfs
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
+	"time"
 )
 
 const zfsPath = "/usr/sbin/zfs"
 const zpoolPath = "/usr/sbin/zpool"
 
+// PreflightResult is the outcome of the pre-flight checks run when the package is loaded.
+type PreflightResult struct {
+	ZFSPath      string `json:"zfsPath"`
+	ZpoolPath    string `json:"zpoolPath"`
+	ZFSVersion   string `json:"zfsVersion"`   // first line of `zfs version` without the zfs- prefix, e.g. 2.2.2-1
+	ZpoolVersion string `json:"zpoolVersion"` // first line of `zpool version` without the zfs- prefix
+	OK           bool   `json:"ok"`
+	Error        string `json:"error,omitempty"`
+}
+
+// preflightTimeout bounds each command of the pre-flight checks.
+const preflightTimeout = 5 * time.Second
+
+// preflightResult is the result of the pre-flight checks.
+var preflightResult PreflightResult
+
+// preflightErr is the error of the pre-flight checks, New returns it when set.
+var preflightErr error
+
 // Perform pre-flight checks to sufficiently use this module.
 func init() {
+	preflightResult, preflightErr = preflight()
+}
+
+// Preflight returns the result of the pre-flight checks, for logging or inspecting the zfs installation.
+func Preflight() PreflightResult {
+	return preflightResult
+}
 
-	var err error
+// preflight checks the zfs and zpool binaries exist and succeed on `version`.
+func preflight() (r PreflightResult, err error) {
+
+	r.ZFSPath, r.ZpoolPath = zfsPath, zpoolPath
+	defer func() {
+		r.OK = err == nil
+		if err != nil {
+			r.Error = err.Error()
+		}
+	}()
 
 	// zfs check
 	// check if the zfs binary exists
 	// check if success on `zfs version`
-	{
-		_, err = os.ReadFile(zfsPath)
-		if err != nil {
-			log.Printf("%s not found", zfsPath)
-			log.Fatal(err)
+	// zpool check
+	// check if the zpool binary exists
+	// check if success on `zpool version`
+	versions := map[string]*string{zfsPath: &r.ZFSVersion, zpoolPath: &r.ZpoolVersion}
+	for _, binary := range []string{zfsPath, zpoolPath} {
+		if _, err := os.Stat(binary); err != nil {
+			return r, errors.Wrapf(ErrZFSUnavailable, "%s not found", binary)
 		}
 
-		cmd := exec.Command("zfs", "version")
-		cmdString := getCommandString(cmd)
-		stdout, err := cmd.StdoutPipe()
+		version, err := preflightVersion(binary)
 		if err != nil {
-			log.Fatal(err)
+			return r, err
 		}
+		*versions[binary] = version
+	}
 
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			log.Fatal(err)
-		}
+	return r, nil
+}
 
-		cmd.Start()
-		<-logPipe(stdout, "%s out", cmdString)
-		<-logPipe(stderr, "%s err", cmdString)
-	}
+// preflightVersion runs `version` of the zfs or zpool binary and returns the version from its first line.
+func preflightVersion(binary string) (string, error) {
 
-	// check zpool
-	// check if the zpool binary exists
-	// check if success on `zpool version`
-	{
-		_, err = os.ReadFile(zpoolPath)
-		if err != nil {
-			log.Printf("%s not found", zpoolPath)
-			log.Fatal(err)
-		}
+	// a wedged zfs must not hang the process at start up
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary, "version")
+	cmd.Env = defaultEnviron()
+	cmdString := getCommandString(cmd)
 
-		cmd := exec.Command(zpoolPath, "version")
-		cmdString := getCommandString(cmd)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
 
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			log.Fatal(err)
-		}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", errors.Wrapf(ErrZFSUnavailable, "unable to run command %q: %s", cmdString, err)
+	}
 
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			log.Fatal(err)
+	if err := cmd.Start(); err != nil {
+		return "", errors.Wrapf(ErrZFSUnavailable, "unable to run command %q: %s", cmdString, err)
+	}
+	<-logPipe(stderr, "%s err", cmdString)
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", errors.Wrapf(ErrZFSUnavailable, "command %q timed out after %s", cmdString, preflightTimeout)
 		}
-		cmd.Start()
-		<-logPipe(stdout, "%s out", cmdString)
-		<-logPipe(stderr, "%s err", cmdString)
+		return "", errors.Wrapf(ErrZFSUnavailable, "command %q failed: %s", cmdString, err)
+	}
+
+	// log the output and capture the version from its first line
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	for _, line := range lines {
+		log.Printf("%s out: %s", cmdString, line)
 	}
+	return strings.TrimPrefix(lines[0], "zfs-"), nil
 }
 
 // getCommandString returns a string of the command and args of a *exec.Cmd type
@@ -0,0 +1,146 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Version returns the version of the zfs userland utilities on the host, e.g. "2.3.0-1".
+func Version() (string, error) {
+	return Zpool{}.Version()
+}
+
+// Version returns the version of the zfs userland utilities, e.g. "2.3.0-1", running `zfs version` with the
+// runner, timeout and environment of the zpool.
+func (z Zpool) Version() (string, error) {
+
+	// zfs version prints the userland version on the first line, e.g. zfs-2.3.0-1
+	cmd := command(zfsPath, "version")
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return "", errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	line := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+	if strings.HasPrefix(line, "zfs-") == false {
+		return "", errors.Errorf("unable to parse zfs version %q", line)
+	}
+
+	return strings.TrimPrefix(line, "zfs-"), nil
+}
+
+// supportsJSON returns true when the zfs utilities of the zpool support the -j flag, introduced in OpenZFS 2.3.0.
+// The detection runs once per zpool handle from New. A Zpool built without New shares the detection of its runner,
+// the host when none is set, except a runner that isn't comparable, such as a map, is detected on every call.
+func (z Zpool) supportsJSON() bool {
+	if z.state != nil {
+		z.state.jsonOnce.Do(func() {
+			z.state.jsonOutput = z.detectJSON()
+		})
+		return z.state.jsonOutput
+	}
+
+	if z.Runner != nil && !reflect.TypeOf(z.Runner).Comparable() {
+		return z.detectJSON()
+	}
+	if jsonOutput, ok := runnerJSON.Load(z.Runner); ok {
+		return jsonOutput.(bool)
+	}
+	jsonOutput, _ := runnerJSON.LoadOrStore(z.Runner, z.detectJSON())
+	return jsonOutput.(bool)
+}
+
+// runnerJSON caches the JSON output support of zpools built without New by their runner, nil for the host.
+var runnerJSON sync.Map
+
+// detectJSON checks the zfs version for native JSON output support, false when the version is unknown.
+func (z Zpool) detectJSON() bool {
+	v, err := z.Version()
+	if err != nil {
+		return false
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(v, "%d.%d", &major, &minor); err != nil {
+		return false
+	}
+	return major > 2 || (major == 2 && minor >= 3)
+}
+
+// getProperties runs `zfs get` with the flags for the exact values of the properties of the target datasets.
+// It returns the property values per dataset name and the dataset names in order.
+// The native JSON output is used when supported, otherwise the tab separated output is parsed.
+func (z Zpool) getProperties(flags []string, properties string, targets ...string) (props map[string]map[string]string, names []string, err error) {
+
+	// zfs get -jp -t filesystem -r guid,createtxg tank
+	// zfs get -Hpo name,property,value -t filesystem -r guid,createtxg tank
+	// detect once, so the output is parsed in the format it was asked for
+	jsonOutput := z.supportsJSON()
+	var args []string
+	if jsonOutput {
+		args = append([]string{"get", "-jp"}, flags...)
+	} else {
+		args = append([]string{"get", "-Hpo", "name,property,value"}, flags...)
+	}
+	args = append(append(args, properties), targets...)
+	cmd := command(zfsPath, args...)
+
+	// execute command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return props, names, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	if jsonOutput {
+		props, names, err = parseJSONProperties(out)
+		return props, names, err
+	}
+
+	return parseProperties(out)
+}
+
+// jsonProperties is the output of `zfs get -j`.
+type jsonProperties struct {
+	Datasets map[string]struct {
+		Name       string `json:"name"`
+		Properties map[string]struct {
+			Value string `json:"value"`
+		} `json:"properties"`
+	} `json:"datasets"`
+}
+
+// parseJSONProperties parses the output of `zfs get -j` into a map of property values per dataset name.
+// The dataset names are returned sorted.
+func parseJSONProperties(out []byte) (props map[string]map[string]string, names []string, err error) {
+
+	props = make(map[string]map[string]string)
+	names = make([]string, 0)
+
+	// no output when no datasets match, e.g. a zpool without snapshots
+	if len(bytes.TrimSpace(out)) == 0 {
+		return props, names, nil
+	}
+
+	var j jsonProperties
+	if err := json.Unmarshal(out, &j); err != nil {
+		return props, names, errors.Wrap(err, "unable to parse zfs json output")
+	}
+
+	for _, ds := range j.Datasets {
+		props[ds.Name] = make(map[string]string)
+		for property, p := range ds.Properties {
+			props[ds.Name][property] = p.Value
+		}
+		names = append(names, ds.Name)
+	}
+	sort.Strings(names)
+
+	return props, names, nil
+}
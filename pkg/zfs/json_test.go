@@ -0,0 +1,64 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	needsZpool(t)
+
+	v, err := Version()
+	if err != nil {
+		t.Errorf("unable to get zfs version, received %+v", err)
+	} else {
+		t.Logf("found zfs version %s, json output: %t", v, z.supportsJSON())
+	}
+}
+
+func TestParseJSONProperties(t *testing.T) {
+
+	out := []byte(`{
+  "output_version": {"command": "zfs get", "vers_major": 0, "vers_minor": 1},
+  "datasets": {
+    "tank/a": {
+      "name": "tank/a",
+      "type": "FILESYSTEM",
+      "pool": "tank",
+      "createtxg": "42",
+      "properties": {
+        "guid": {"value": "1234", "source": {"type": "NONE", "data": "-"}},
+        "createtxg": {"value": "42", "source": {"type": "NONE", "data": "-"}}
+      }
+    },
+    "tank": {
+      "name": "tank",
+      "type": "FILESYSTEM",
+      "pool": "tank",
+      "createtxg": "1",
+      "properties": {
+        "guid": {"value": "5678", "source": {"type": "NONE", "data": "-"}},
+        "createtxg": {"value": "1", "source": {"type": "NONE", "data": "-"}}
+      }
+    }
+  }
+}`)
+
+	props, names, err := parseJSONProperties(out)
+	if err != nil {
+		t.Errorf("unable to parse json properties, received %+v", err)
+	} else if len(names) != 2 || names[0] != "tank" || names[1] != "tank/a" {
+		t.Errorf("expected datasets [tank tank/a], found %v", names)
+	} else if props["tank/a"]["guid"] != "1234" || props["tank/a"]["createtxg"] != "42" {
+		t.Errorf("unexpected properties of tank/a, found %v", props["tank/a"])
+	}
+
+	// empty output case
+	if props, names, err := parseJSONProperties([]byte("\n")); err != nil || props == nil || len(names) != 0 {
+		t.Errorf("empty json output should parse to no datasets, found %v, received %+v", names, err)
+	}
+
+	// bad json case
+	if _, _, err := parseJSONProperties([]byte("tank\tguid\t1234")); err == nil {
+		t.Errorf("parsing tab separated output as json should fail")
+	}
+}
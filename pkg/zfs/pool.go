@@ -0,0 +1,409 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// PoolCapacity is the pool-level space usage, which accounts for raidz parity and pool overhead.
+type PoolCapacity struct {
+	Size          int64 `json:"size"`
+	Allocated     int64 `json:"allocated"`
+	Free          int64 `json:"free"`
+	Capacity      int64 `json:"capacity"`      // percent of size allocated
+	Fragmentation int64 `json:"fragmentation"` // percent, zero when the pool doesn't report it
+}
+
+// Capacity returns the size, allocated and free bytes of the zpool.
+func (z Zpool) Capacity() (c PoolCapacity, err error) {
+
+	// zpool list -Hp -o size,alloc,free,capacity,fragmentation tank
+	cmd := command(zpoolPath, "list", "-Hp", "-o", "size,alloc,free,capacity,fragmentation", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return c, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// parse the single tab separated line
+	fields := strings.Split(strings.TrimSpace(string(out)), "\t")
+	if len(fields) != 5 {
+		return c, errors.Errorf("unable to parse zpool list output %q", out)
+	}
+
+	// fragmentation is "-" on pools without the spacemap_histogram feature
+	values := make([]int64, len(fields))
+	for i, value := range fields {
+		p, err := parseInt("zpool list", strings.TrimSuffix(value, "%"))
+		if err != nil {
+			return c, err
+		}
+		values[i] = p
+	}
+
+	c.Size, c.Allocated, c.Free, c.Capacity, c.Fragmentation = values[0], values[1], values[2], values[3], values[4]
+	return c, nil
+}
+
+// HasSpace returns true when the zpool has at least the given number of bytes free.
+// It is a best-effort check for admission control, not a guarantee the space is still free when it's used.
+func (z Zpool) HasSpace(bytes int64) (bool, error) {
+
+	c, err := z.Capacity()
+	if err != nil {
+		return false, err
+	}
+
+	return c.Free >= bytes, nil
+}
+
+// FreeingBytes returns the bytes the zpool is still freeing in the background, such as after a large destroy.
+// Free space lags behind by this amount until the background free completes.
+func (z Zpool) FreeingBytes() (int64, error) {
+
+	// zpool get -Hp -o value freeing tank
+	cmd := command(zpoolPath, "get", "-Hp", "-o", "value", "freeing", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return 0, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseInt("freeing", strings.TrimSpace(string(out)))
+}
+
+// DedupRatio returns the deduplication ratio of the zpool, e.g. 1.5 when deduplication saves a third of the space.
+// It is 1 when nothing is deduplicated.
+func (z Zpool) DedupRatio() (float64, error) {
+
+	// zpool get -Hp -o value dedupratio tank
+	cmd := command(zpoolPath, "get", "-Hp", "-o", "value", "dedupratio", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return 0, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseRatio("dedupratio", strings.TrimSpace(string(out)))
+}
+
+type Vdev struct {
+	Name    string   `json:"name"`    // e.g. mirror-0, raidz1-0 or the device path of a single disk
+	Type    string   `json:"type"`    // mirror, raidz1, raidz2, raidz3, draid or disk
+	Class   string   `json:"class"`   // empty for data vdevs, otherwise logs, cache, spares, special or dedup
+	State   string   `json:"state"`   // e.g. ONLINE, DEGRADED, FAULTED, AVAIL for spares
+	Devices []string `json:"devices"` // member device paths, a disk vdev is its own single member
+}
+
+// vdevClasses are the headings of the non-data vdev sections in the `zpool status` config.
+var vdevClasses = map[string]bool{"logs": true, "cache": true, "spares": true, "special": true, "dedup": true}
+
+// vdevTypes are the name prefixes of the grouping vdev types, the name is the type followed by -<index>.
+var vdevTypes = []string{"mirror", "raidz", "draid"}
+
+// Vdevs returns the top-level vdevs of the zpool with their member devices.
+func (z Zpool) Vdevs() ([]Vdev, error) {
+
+	// zpool status -P tank
+	cmd := command(zpoolPath, "status", "-P", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return nil, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseVdevs(out, z.Name)
+}
+
+// parseVdevs parses the config section of `zpool status` output into the top-level vdevs.
+// Devices nested deeper than a top-level vdev, such as those being replaced, are members of the top-level vdev.
+func parseVdevs(out []byte, zpool string) (vdevs []Vdev, err error) {
+
+	// zpool status -P example
+	// config:
+	//
+	// 	NAME                STATE     READ WRITE CKSUM
+	// 	tank                ONLINE       0     0     0
+	// 	  mirror-0          ONLINE       0     0     0
+	// 	    /dev/sda1       ONLINE       0     0     0
+	// 	    /dev/sdb1       ONLINE       0     0     0
+	// 	logs
+	// 	  /dev/sdc1         ONLINE       0     0     0
+	// 	spares
+	// 	  /dev/sdd1         AVAIL
+	//
+	// errors: No known data errors
+	vdevs = make([]Vdev, 0)
+	inConfig, class := false, ""
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := in.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// find the vdev table, it ends at the next blank line after it started
+		if !inConfig {
+			inConfig = strings.HasPrefix(trimmed, "NAME") && strings.Contains(trimmed, "STATE")
+			continue
+		}
+		if len(trimmed) == 0 {
+			break
+		}
+
+		// depth is the number of spaces after the leading tab, two per level
+		depth := len(strings.TrimPrefix(line, "\t")) - len(strings.TrimLeft(strings.TrimPrefix(line, "\t"), " "))
+		fields := strings.Fields(trimmed)
+
+		switch {
+		case depth == 0 && fields[0] == zpool:
+			class = ""
+		case depth == 0 && vdevClasses[fields[0]]:
+			class = fields[0]
+		case depth == 0:
+			return vdevs, errors.Errorf("unable to parse zpool status config line %q", line)
+		case depth == 2:
+			v := Vdev{Name: fields[0], Type: "disk", Class: class}
+			if len(fields) > 1 {
+				v.State = fields[1]
+			}
+			for _, t := range vdevTypes {
+				if strings.HasPrefix(v.Name, t) {
+					if i := strings.LastIndex(v.Name, "-"); i != -1 {
+						v.Type = v.Name[:i]
+					}
+				}
+			}
+			if v.Type == "disk" {
+				v.Devices = []string{v.Name}
+			}
+			vdevs = append(vdevs, v)
+		default:
+			if len(vdevs) == 0 {
+				return vdevs, errors.Errorf("unable to parse zpool status config line %q", line)
+			}
+			// devices are absolute paths with -P, nested groups like replacing-0 aren't devices
+			if strings.HasPrefix(fields[0], "/") {
+				last := &vdevs[len(vdevs)-1]
+				last.Devices = append(last.Devices, fields[0])
+			}
+		}
+	}
+
+	if !inConfig {
+		return vdevs, errors.Errorf("unable to find config in zpool status output")
+	}
+
+	return vdevs, nil
+}
+
+// Status is the health of the zpool from `zpool status`.
+type Status struct {
+	State   string         `json:"state"`   // e.g. ONLINE, DEGRADED, SUSPENDED
+	Devices []DeviceStatus `json:"devices"` // rows of the config table in order: the zpool, its vdevs and their devices
+}
+
+// DeviceStatus is the state and error counters of the zpool, a vdev or a device.
+type DeviceStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Read     int64  `json:"read"`
+	Write    int64  `json:"write"`
+	Checksum int64  `json:"checksum"`
+}
+
+// Status returns the state of the zpool along with the error counters of its vdevs and devices.
+func (z Zpool) Status() (Status, error) {
+
+	// zpool status -Pp tank
+	cmd := command(zpoolPath, "status", "-Pp", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return Status{}, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseStatus(out)
+}
+
+// parseStatus parses the state and the config table of `zpool status -p` output.
+// Rows without counters, such as the logs heading or an available spare, are left out of the devices.
+func parseStatus(out []byte) (st Status, err error) {
+
+	st.Devices = make([]DeviceStatus, 0)
+	inConfig := false
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := in.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if !inConfig {
+			if strings.HasPrefix(trimmed, "state:") {
+				st.State = strings.TrimSpace(strings.TrimPrefix(trimmed, "state:"))
+			}
+			inConfig = strings.HasPrefix(trimmed, "NAME") && strings.Contains(trimmed, "STATE")
+			continue
+		}
+		if len(trimmed) == 0 {
+			break
+		}
+
+		// a device may be followed by a note, e.g. /dev/sdb1 FAULTED 3 0 0 too many errors
+		fields := strings.Fields(trimmed)
+		if len(fields) < 5 {
+			continue
+		}
+		d := DeviceStatus{Name: fields[0], State: fields[1]}
+		for i, counter := range []*int64{&d.Read, &d.Write, &d.Checksum} {
+			if *counter, err = strconv.ParseInt(fields[2+i], 10, 64); err != nil {
+				return st, errors.Errorf("unable to parse zpool status config line %q", line)
+			}
+		}
+		st.Devices = append(st.Devices, d)
+	}
+
+	if !inConfig {
+		return st, errors.Errorf("unable to find config in zpool status output")
+	}
+
+	return st, nil
+}
+
+// ClearErrors clears the error counters of the device, or of every device of the zpool when device is empty.
+func (z *Zpool) ClearErrors(device string) error {
+
+	// zpool clear tank /dev/sda1
+	args := []string{"clear", z.Name}
+	if len(device) > 0 {
+		args = append(args, device)
+	}
+	cmd := command(zpoolPath, args...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. device isn't in the zpool
+		// 2. zpool fails
+		return errors.Wrapf(err, "unable to clear errors of %q on zpool %q", device, z.Name)
+	}
+
+	return nil
+}
+
+// Export exports the zpool, after which the Zpool can't be used until the zpool is imported again.
+// When force is true the datasets are forcefully unmounted.
+func (z Zpool) Export(force bool) error {
+
+	// zpool export -f tank
+	args := []string{"export"}
+	if force {
+		args = append(args, "-f")
+	}
+	cmd := command(zpoolPath, append(args, z.Name)...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. datasets are busy and force is false
+		// 2. zpool doesn't exist
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
+
+// ImportOptions are the options of ImportZpool.
+type ImportOptions struct {
+	AltRoot  string   // mount the datasets relative to the alternate root, -R
+	ReadOnly bool     // import read-only, -o readonly=on
+	Dirs     []string // search the directories for devices, -d
+	Force    bool     // import a zpool that appears in use by another system, -f
+}
+
+// ImportZpool imports the zpool and returns it.
+func ImportZpool(name string, opts ImportOptions) (Zpool, error) {
+
+	if len(name) == 0 || strings.ContainsAny(name, "/@# ") {
+		return Zpool{}, errors.Errorf("bad zpool name %q", name)
+	}
+
+	// alternate root must be an absolute path
+	if len(opts.AltRoot) > 0 && !strings.HasPrefix(opts.AltRoot, "/") {
+		return Zpool{}, errors.Errorf("alternate root %q must be an absolute path", opts.AltRoot)
+	}
+
+	// zpool import -R /mnt -o readonly=on -d /dev/disk/by-id -f tank
+	args := []string{"import"}
+	if len(opts.AltRoot) > 0 {
+		args = append(args, "-R", opts.AltRoot)
+	}
+	if opts.ReadOnly {
+		args = append(args, "-o", "readonly=on")
+	}
+	for _, dir := range opts.Dirs {
+		args = append(args, "-d", dir)
+	}
+	if opts.Force {
+		args = append(args, "-f")
+	}
+	cmd := command(zpoolPath, append(args, name)...)
+
+	// run command, with the defaults of a zpool as there is none yet
+	if _, err := (Zpool{}).run(cmd); err != nil {
+		// known ways to fail
+		// 1. zpool not found on the devices
+		// 2. zpool is in use by another system and force is false
+		// 3. zpool is already imported
+		cmdString := getCommandString(cmd)
+		return Zpool{}, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return New(name)
+}
+
+// zpoolWaitActivities are the activities `zpool wait` can wait for, deleteq is waited for with `zfs wait`.
+var zpoolWaitActivities = map[string]bool{"discard": true, "free": true, "initialize": true, "replace": true, "remove": true, "resilver": true, "scrub": true, "trim": true}
+
+// Wait blocks until the background activity of the zpool completes, such as free after a large destroy.
+// The activity is deleteq, waited for on the zpool's root filesystem, or one of the `zpool wait` activities.
+// The command is killed when the context is done.
+func (z Zpool) Wait(ctx context.Context, activity string) error {
+
+	// zfs wait -t deleteq tank
+	// zpool wait -t free tank
+	var cmd *exec.Cmd
+	switch {
+	case activity == "deleteq":
+		cmd = commandContext(ctx, zfsPath, "wait", "-t", activity, z.Name)
+	case zpoolWaitActivities[activity]:
+		cmd = commandContext(ctx, zpoolPath, "wait", "-t", activity, z.Name)
+	default:
+		return errors.Errorf("unable to wait for activity %q", activity)
+	}
+	cmd.Env = z.environ()
+
+	// run command with the runner, the context rather than the zpool timeout bounds the wait
+	if _, err := z.runner().Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "activity %q of zpool %q still in progress", activity, z.Name)
+		}
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCapacity(t *testing.T) {
+	needsZpool(t)
+
+	c, err := z.Capacity()
+	if err != nil {
+		t.Errorf("unable to get capacity of %s, received %+v", z.Name, err)
+	} else {
+		t.Logf("zpool %s size: %d, allocated: %d, free: %d, capacity: %d%%, fragmentation: %d%%\n", z.Name, c.Size, c.Allocated, c.Free, c.Capacity, c.Fragmentation)
+		if c.Size == 0 || c.Allocated > c.Size || c.Free > c.Size {
+			t.Errorf("zpool %s allocated %d or free %d exceeds size %d", z.Name, c.Allocated, c.Free, c.Size)
+		}
+	}
+}
+
+func TestHasSpace(t *testing.T) {
+	needsZpool(t)
+
+	c, err := z.Capacity()
+	if err != nil {
+		t.Errorf("unable to get capacity of %s, received %+v", z.Name, err)
+	}
+
+	// zero bytes always fits
+	if ok, err := z.HasSpace(0); err != nil || !ok {
+		t.Errorf("zpool %s should have space for 0 bytes, received %+v", z.Name, err)
+	}
+
+	// more than the zpool size never fits
+	if ok, err := z.HasSpace(c.Size + 1); err != nil || ok {
+		t.Errorf("zpool %s should not have space for %d bytes, received %+v", z.Name, c.Size+1, err)
+	}
+}
+
+func TestFreeingBytes(t *testing.T) {
+	needsZpool(t)
+
+	freeing, err := z.FreeingBytes()
+	if err != nil {
+		t.Errorf("unable to get freeing bytes of %s, received %+v", z.Name, err)
+	} else {
+		t.Logf("zpool %s is freeing %d bytes\n", z.Name, freeing)
+		if freeing < 0 {
+			t.Errorf("zpool %s freeing bytes %d should not be negative", z.Name, freeing)
+		}
+	}
+}
+
+func TestDedupRatio(t *testing.T) {
+	needsZpool(t)
+
+	r, err := z.DedupRatio()
+	if err != nil {
+		t.Errorf("unable to get dedup ratio of %q, received %+v", z.Name, err)
+	} else {
+		t.Logf("dedup ratio of %s is %.2f", z.Name, r)
+		if r < 1 {
+			t.Errorf("dedup ratio of %q should be at least 1, found %v", z.Name, r)
+		}
+	}
+}
+
+func TestParseVdevs(t *testing.T) {
+
+	// mirror with a device being replaced, a log and a spare
+	mirror := "  pool: tank\n state: ONLINE\nconfig:\n\n" +
+		"\tNAME                STATE     READ WRITE CKSUM\n" +
+		"\ttank                DEGRADED     0     0     0\n" +
+		"\t  mirror-0          DEGRADED     0     0     0\n" +
+		"\t    /dev/sda1       ONLINE       0     0     0\n" +
+		"\t    replacing-1     DEGRADED     0     0     0\n" +
+		"\t      /dev/sdb1     FAULTED      0     0     0\n" +
+		"\t      /dev/sde1     ONLINE       0     0     0\n" +
+		"\tlogs\n" +
+		"\t  /dev/sdc1         ONLINE       0     0     0\n" +
+		"\tspares\n" +
+		"\t  /dev/sdd1         AVAIL\n" +
+		"\nerrors: No known data errors\n"
+
+	vdevs, err := parseVdevs([]byte(mirror), "tank")
+	if err != nil {
+		t.Errorf("unable to parse mirror config, received %+v", err)
+	} else if len(vdevs) != 3 {
+		t.Errorf("parsed %d vdevs, expected 3: %+v", len(vdevs), vdevs)
+	} else {
+		if v := vdevs[0]; v.Type != "mirror" || v.State != "DEGRADED" || len(v.Devices) != 3 {
+			t.Errorf("parsed mirror vdev %+v", v)
+		}
+		if v := vdevs[1]; v.Type != "disk" || v.Class != "logs" || v.Devices[0] != "/dev/sdc1" {
+			t.Errorf("parsed log vdev %+v", v)
+		}
+		if v := vdevs[2]; v.Class != "spares" || v.State != "AVAIL" {
+			t.Errorf("parsed spare vdev %+v", v)
+		}
+	}
+
+	// two raidz vdevs
+	raidz := "  pool: tank\n state: ONLINE\nconfig:\n\n" +
+		"\tNAME                STATE     READ WRITE CKSUM\n" +
+		"\ttank                ONLINE       0     0     0\n" +
+		"\t  raidz1-0          ONLINE       0     0     0\n" +
+		"\t    /dev/sda1       ONLINE       0     0     0\n" +
+		"\t    /dev/sdb1       ONLINE       0     0     0\n" +
+		"\t    /dev/sdc1       ONLINE       0     0     0\n" +
+		"\t  raidz2-1          ONLINE       0     0     0\n" +
+		"\t    /dev/sdd1       ONLINE       0     0     0\n" +
+		"\t    /dev/sde1       ONLINE       0     0     0\n" +
+		"\t    /dev/sdf1       ONLINE       0     0     0\n" +
+		"\t    /dev/sdg1       ONLINE       0     0     0\n" +
+		"\nerrors: No known data errors\n"
+
+	vdevs, err = parseVdevs([]byte(raidz), "tank")
+	if err != nil {
+		t.Errorf("unable to parse raidz config, received %+v", err)
+	} else if len(vdevs) != 2 || vdevs[0].Type != "raidz1" || len(vdevs[0].Devices) != 3 || vdevs[1].Type != "raidz2" || len(vdevs[1].Devices) != 4 {
+		t.Errorf("parsed raidz vdevs %+v", vdevs)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+
+	// a faulted device with errors and a note, a log and a spare
+	out := "  pool: tank\n state: DEGRADED\nconfig:\n\n" +
+		"\tNAME                STATE     READ WRITE CKSUM\n" +
+		"\ttank                DEGRADED     0     0     0\n" +
+		"\t  mirror-0          DEGRADED     0     0     0\n" +
+		"\t    /dev/sda1       ONLINE       0     0     2\n" +
+		"\t    /dev/sdb1       FAULTED     12     3     0  too many errors\n" +
+		"\tlogs\n" +
+		"\t  /dev/sdc1         ONLINE       0     0     0\n" +
+		"\tspares\n" +
+		"\t  /dev/sdd1         AVAIL\n" +
+		"\nerrors: No known data errors\n"
+
+	st, err := parseStatus([]byte(out))
+	if err != nil {
+		t.Errorf("unable to parse status, received %+v", err)
+	} else if st.State != "DEGRADED" || len(st.Devices) != 5 {
+		t.Errorf("parsed status %+v, expected DEGRADED with 5 devices", st)
+	} else {
+		if d := st.Devices[2]; d.Name != "/dev/sda1" || d.Checksum != 2 {
+			t.Errorf("parsed device %+v", d)
+		}
+		if d := st.Devices[3]; d.Name != "/dev/sdb1" || d.State != "FAULTED" || d.Read != 12 || d.Write != 3 {
+			t.Errorf("parsed device %+v", d)
+		}
+	}
+
+	// bogus counter case
+	bogus := "config:\n\n\tNAME STATE READ WRITE CKSUM\n\ttank ONLINE 0 x 0\n"
+	if _, err := parseStatus([]byte(bogus)); err == nil {
+		t.Errorf("parsing bogus counters should fail")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	needsZpool(t)
+
+	st, err := z.Status()
+	if err != nil {
+		t.Errorf("unable to get status of %q, received %+v", z.Name, err)
+	} else {
+		t.Logf("status of %s: %+v", z.Name, st)
+	}
+
+	// clear the counters of every device
+	if err := z.ClearErrors(""); err != nil {
+		t.Errorf("unable to clear errors of %q, received %+v", z.Name, err)
+	}
+
+	// bogus device case
+	if err := z.ClearErrors("/dev/bogus"); err == nil {
+		t.Errorf("clearing errors of bogus device should fail")
+	}
+}
+
+func TestVdevs(t *testing.T) {
+	needsZpool(t)
+
+	vdevs, err := z.Vdevs()
+	if err != nil {
+		t.Errorf("unable to get vdevs of %s, received %+v", z.Name, err)
+	} else {
+		for _, v := range vdevs {
+			t.Logf("found vdev %s, type: %s, state: %s, devices: %v\n", v.Name, v.Type, v.State, v.Devices)
+		}
+		if len(vdevs) == 0 {
+			t.Errorf("zpool %s should have at least one vdev", z.Name)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	needsZpool(t)
+
+	// bogus zpool case
+	bogus := Zpool{Name: "bogus"}
+	if err := bogus.Export(false); err == nil {
+		t.Errorf("exporting zpool %q should fail", bogus.Name)
+	}
+	if _, err := ImportZpool(bogus.Name, ImportOptions{}); err == nil {
+		t.Errorf("importing zpool %q should fail", bogus.Name)
+	}
+
+	// bad options case
+	if _, err := ImportZpool(z.Name, ImportOptions{AltRoot: "relative"}); err == nil {
+		t.Errorf("importing with a relative alternate root should fail")
+	}
+
+	// importing an imported zpool case
+	if _, err := ImportZpool(z.Name, ImportOptions{}); err == nil {
+		t.Errorf("importing the already imported zpool %q should fail", z.Name)
+	}
+}
+
+func TestWait(t *testing.T) {
+	needsZpool(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// nothing is being freed, so these return once checked
+	for _, activity := range []string{"free", "deleteq"} {
+		if err := z.Wait(ctx, activity); err != nil {
+			t.Errorf("unable to wait for %s on %s, received %+v", activity, z.Name, err)
+		}
+	}
+
+	// bogus activity case
+	if err := z.Wait(ctx, "bogus"); err == nil {
+		t.Errorf("waiting for bogus activity should fail")
+	}
+}
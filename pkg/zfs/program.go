@@ -0,0 +1,36 @@
+package zfs
+
+import (
+	"github.com/pkg/errors"
+	"os/exec"
+	"strings"
+)
+
+// RunProgram runs the Lua channel program at the script path on the zpool with `zfs program -j`, and returns its
+// JSON output. A channel program runs in a single transaction group, so its operations apply atomically.
+// The script arguments are passed to the program as given.
+func (z *Zpool) RunProgram(script string, args []string) (string, error) {
+
+	if len(script) == 0 {
+		return "", errors.Errorf("no channel program given for zpool %q", z.Name)
+	}
+
+	// zfs program -j tank /path/to/script.lua arg1 arg2
+	cmd := command(zfsPath, append([]string{"program", "-j", z.Name, script}, args...)...)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		// known ways to fail
+		// 1. script doesn't exist
+		// 2. script fails to compile or raises an error
+		// 3. script exceeds the instruction or memory limit
+		cmdString := getCommandString(cmd)
+		if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok {
+			return string(out), errors.Wrapf(err, "unable to run command %q: %s", cmdString, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return string(out), errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return string(out), nil
+}
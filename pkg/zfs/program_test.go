@@ -0,0 +1,39 @@
+package zfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunProgram(t *testing.T) {
+	needsZpool(t)
+
+	// a channel program returning its argument
+	script := filepath.Join(t.TempDir(), "echo.lua")
+	if err := os.WriteFile(script, []byte("args = ...\nreturn args[\"argv\"][1]\n"), 0644); err != nil {
+		t.Errorf("unable to write channel program %q, received %+v", script, err)
+		return
+	}
+
+	out, err := z.RunProgram(script, []string{"hello"})
+	if err != nil {
+		t.Errorf("unable to run channel program %q, received %+v", script, err)
+	} else {
+		t.Logf("channel program output %s", out)
+		if !strings.Contains(out, "hello") {
+			t.Errorf("channel program output %q should contain %q", out, "hello")
+		}
+	}
+
+	// failing channel program case
+	bad := filepath.Join(t.TempDir(), "bad.lua")
+	if err := os.WriteFile(bad, []byte("error(\"boom\")\n"), 0644); err != nil {
+		t.Errorf("unable to write channel program %q, received %+v", bad, err)
+		return
+	}
+	if _, err := z.RunProgram(bad, nil); err == nil {
+		t.Errorf("failing channel program %q should fail", bad)
+	}
+}
@@ -0,0 +1,322 @@
+package zfs
+
+import (
+	"github.com/pkg/errors"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrPropertyNotInheritable is returned when a property can't be inherited, such as a read-only property.
+var ErrPropertyNotInheritable = errors.New("property cannot be inherited")
+
+// InheritProperty clears the local value of the property on the dataset so it inherits the value from its parent.
+// When recursive is true the property is also inherited on all descendants.
+func (z *Zpool) InheritProperty(dataset, property string, recursive bool) error {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || len(property) == 0 || !z.owns(dataset) {
+		return errors.Errorf("property %q cannot be inherited on dataset %q on zpool %q", property, dataset, z.Name)
+	}
+
+	// zfs inherit -r compression tank/a
+	args := []string{"inherit"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, property, dataset)
+	cmd := command(zfsPath, args...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. property is read-only or can't be inherited
+		// 2. dataset doesn't exist
+		// 3. zfs fails
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr := string(exitErr.Stderr)
+			if strings.Contains(stderr, "cannot be inherited") || strings.Contains(stderr, "read-only") {
+				return errors.Wrapf(ErrPropertyNotInheritable, "unable to inherit property %q on %q: %s", property, dataset, strings.TrimSpace(stderr))
+			}
+		}
+		return errors.Wrapf(err, "unable to inherit property %q on %q", property, dataset)
+	}
+
+	return nil
+}
+
+// ReceivedProperty is a property's effective value alongside the value set by the last `zfs receive`.
+type ReceivedProperty struct {
+	Value    string `json:"value"`    // effective value
+	Received string `json:"received"` // value from the last receive, "-" when not received
+	Source   string `json:"source"`   // e.g. local, received, inherited from tank, default
+}
+
+// GetReceivedProperty returns the effective and received values of the property on the dataset.
+// A property was overridden locally when its source is local and its received value differs.
+func (z Zpool) GetReceivedProperty(dataset, property string) (p ReceivedProperty, err error) {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || len(property) == 0 || !z.owns(dataset) {
+		return p, errors.Errorf("bad request for property %q on dataset %q on zpool %q", property, dataset, z.Name)
+	}
+
+	// zfs get -Hp -o value,received,source compression tank/a
+	cmd := command(zfsPath, "get", "-Hp", "-o", "value,received,source", property, dataset)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		return p, errors.Wrapf(err, "property %q on %q not found", property, dataset)
+	}
+
+	// parse the single tab separated line
+	fields := strings.Split(strings.TrimRight(string(out), "\n"), "\t")
+	if len(fields) != 3 {
+		return p, errors.Errorf("unable to parse zfs get output %q", out)
+	}
+	p.Value, p.Received, p.Source = fields[0], fields[1], fields[2]
+
+	return p, nil
+}
+
+// WrittenSince returns the bytes written to the filesystem since the snapshot, from the written@snapshot property.
+// The snapshot is given by its short name or its full name on the filesystem.
+func (z Zpool) WrittenSince(filesystem, snapshot string) (int64, error) {
+
+	// short circuit to error if the filesystem isn't on the zpool
+	if len(filesystem) == 0 || !z.owns(filesystem) || strings.ContainsAny(filesystem, "@#") {
+		return 0, errors.Errorf("bad request for written of %q on zpool %q", filesystem, z.Name)
+	}
+
+	// the snapshot must be a snapshot of the filesystem
+	name, err := snapshotOf(filesystem, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	property := "written@" + (&Snapshot{Name: name}).ShortName()
+
+	// zfs get -Hpo value written@snap tank/a
+	cmd := command(zfsPath, "get", "-Hpo", "value", property, filesystem)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		// known ways to fail
+		// 1. filesystem doesn't exist
+		// 2. snapshot doesn't exist
+		cmdString := getCommandString(cmd)
+		return 0, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseInt(property, strings.TrimSpace(string(out)))
+}
+
+// SetProperty sets the property on the dataset.
+func (z *Zpool) SetProperty(dataset, property, value string) error {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || len(property) == 0 || !z.owns(dataset) {
+		return errors.Errorf("property %q cannot be set on dataset %q on zpool %q", property, dataset, z.Name)
+	}
+
+	// zfs set compression=zstd tank/a
+	cmd := command(zfsPath, "set", property+"="+value, dataset)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		return errors.Wrapf(err, "unable to set property %q to %q on %q", property, value, dataset)
+	}
+
+	return nil
+}
+
+// commentProperty is the user property holding the annotation of a snapshot, such as "before DB migration".
+const commentProperty = "user:comment"
+
+// snapshotSources are the property sources fetched for snapshots. Snapshots inherit user properties from their
+// filesystem, leaving out inherited values keeps a comment on a filesystem off its snapshots. The native snapshot
+// properties have no source, so they are kept.
+const snapshotSources = "local,received,none"
+
+// SetSnapshotComment annotates the snapshot with the comment, an empty comment removes it.
+// User properties can be set on snapshots even though their data is read-only.
+func (z *Zpool) SetSnapshotComment(snapshot, comment string) error {
+
+	// snapshot name should start with zpool name
+	if !strings.Contains(snapshot, "@") || strings.ContainsAny(snapshot, "#%,") || !z.owns(snapshot) {
+		return errors.Errorf("comment cannot be set on snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	if len(comment) == 0 {
+		return z.InheritProperty(snapshot, commentProperty, false)
+	}
+	return z.SetProperty(snapshot, commentProperty, escapeComment(comment))
+}
+
+// GetSnapshotComment returns the comment of the snapshot, empty when it has none.
+func (z Zpool) GetSnapshotComment(snapshot string) (string, error) {
+
+	// snapshot name should start with zpool name
+	if !strings.Contains(snapshot, "@") || !z.owns(snapshot) {
+		return "", errors.Errorf("bad request for comment of snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	snap, err := z.GetSnapshot(snapshot)
+	if err != nil {
+		return "", err
+	}
+	return snap.Comment, nil
+}
+
+// escapeComment escapes the control characters, backslashes and quotes of the comment like a Go string literal,
+// so a multi-line comment stays on a single line of `zfs get` output.
+func escapeComment(comment string) string {
+	quoted := strconv.Quote(comment)
+	return quoted[1 : len(quoted)-1]
+}
+
+// unescapeComment reverses escapeComment, a value set outside the package that doesn't unescape is returned as is.
+func unescapeComment(value string) string {
+	comment, err := strconv.Unquote(`"` + value + `"`)
+	if err != nil {
+		return value
+	}
+	return comment
+}
+
+// SetQuota sets the quota of the filesystem from a size such as 10G, see ParseSize. A size of none or 0 removes the quota.
+func (z *Zpool) SetQuota(filesystem, size string) error {
+
+	quota := int64(0)
+	if size != "none" {
+		var err error
+		if quota, err = ParseSize(size); err != nil {
+			return err
+		}
+	}
+
+	// zfs set quota=10737418240 tank/a
+	return z.SetProperty(filesystem, "quota", strconv.FormatInt(quota, 10))
+}
+
+// SetProperties sets all the properties on the dataset with a single `zfs set`, so they are changed together.
+// Every property is validated before running the command.
+func (z *Zpool) SetProperties(dataset string, props map[string]string) error {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || len(props) == 0 || !z.owns(dataset) {
+		return errors.Errorf("properties cannot be set on dataset %q on zpool %q", dataset, z.Name)
+	}
+
+	// sorted for a stable command line
+	properties := make([]string, 0, len(props))
+	for property, value := range props {
+		if len(property) == 0 || strings.ContainsAny(property, "= \t\n") || strings.ContainsAny(value, "\n") {
+			return errors.Errorf("bad property %q with value %q", property, value)
+		}
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	// zfs set compression=zstd quota=1073741824 user:owner=a tank/a
+	args := []string{"set"}
+	for _, property := range properties {
+		args = append(args, property+"="+props[property])
+	}
+	cmd := command(zfsPath, append(args, dataset)...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		return errors.Wrapf(err, "unable to set properties %s on %q", strings.Join(properties, ","), dataset)
+	}
+
+	return nil
+}
+
+// SetPropertyRecursive sets the property on the dataset and clears any local value of the property on its descendants.
+// `zfs set` has no recursive flag, the descendants pick up the new value by inheriting it.
+func (z *Zpool) SetPropertyRecursive(dataset, property, value string) error {
+
+	if err := z.SetProperty(dataset, property, value); err != nil {
+		return err
+	}
+
+	// zfs list -H -o name -d 1 -t filesystem,volume tank/a
+	cmd := command(zfsPath, "list", "-H", "-o", "name", "-d", "1", "-t", "filesystem,volume", dataset)
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// inherit recursively on each immediate child, depth 1 includes the dataset itself
+	for _, child := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if child == dataset || len(child) == 0 {
+			continue
+		}
+		if err := z.InheritProperty(child, property, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UserProperties returns the user properties of the dataset, those with a colon in their name such as user:owner.
+// Inherited user properties are included.
+func (z Zpool) UserProperties(dataset string) (props map[string]string, err error) {
+
+	props = make(map[string]string)
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(dataset) == 0 || !z.owns(dataset) {
+		return props, errors.Errorf("bad request for user properties on dataset %q on zpool %q", dataset, z.Name)
+	}
+
+	// zfs get -Hp -o property,value all tank/a
+	cmd := command(zfsPath, "get", "-Hp", "-o", "property,value", "all", dataset)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return props, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// keep the user properties, native property names never contain a colon
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		fields, err := splitFields(line, 2)
+		if err != nil {
+			return props, err
+		}
+		if strings.Contains(fields[0], ":") {
+			props[fields[0]] = fields[1]
+		}
+	}
+
+	return props, nil
+}
+
+// IsEncrypted checks the encryption property of the dataset isn't off, so a raw send keeps it encrypted.
+func (z Zpool) IsEncrypted(name string) (bool, error) {
+
+	// dataset name should start with zpool name
+	if len(name) == 0 || !z.owns(name) {
+		return false, errors.Errorf("bad request for dataset %q on zpool %q", name, z.Name)
+	}
+
+	// zfs get -Ho value encryption tank/a
+	cmd := command(zfsPath, "get", "-Ho", "value", "encryption", name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		return false, errors.Wrapf(err, "dataset %q not found", name)
+	}
+
+	// encryption is off or aes-256-gcm etc.
+	value := strings.TrimSpace(string(out))
+	return value != "off" && value != "-", nil
+}
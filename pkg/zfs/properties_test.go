@@ -0,0 +1,341 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestInheritProperty(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// working case
+	if err := z.InheritProperty(fs.Name, "compression", true); err != nil {
+		t.Errorf("unable to inherit compression on %q, received %+v", fs.Name, err)
+	}
+
+	// read-only property case
+	if err := z.InheritProperty(fs.Name, "guid", false); errors.Cause(err) != ErrPropertyNotInheritable {
+		t.Errorf("inheriting guid on %q should fail with %v, received %+v", fs.Name, ErrPropertyNotInheritable, err)
+	}
+
+	// bogus dataset case
+	if err := z.InheritProperty("bogus/bogus", "compression", false); err == nil {
+		t.Errorf("inheriting on bogus dataset should fail")
+	}
+}
+
+func TestGetReceivedProperty(t *testing.T) {
+	needsZpool(t)
+
+	// a property that wasn't received
+	p, err := z.GetReceivedProperty(z.Name, "compression")
+	if err != nil {
+		t.Errorf("unable to get compression on %q, received %+v", z.Name, err)
+	} else {
+		t.Logf("found compression on %s, value: %s, received: %s, source: %s\n", z.Name, p.Value, p.Received, p.Source)
+		if p.Received != "-" {
+			t.Errorf("compression on %q should not be received, found %q", z.Name, p.Received)
+		}
+	}
+
+	// bogus dataset case
+	if _, err := z.GetReceivedProperty("bogus/bogus", "compression"); err == nil {
+		t.Errorf("getting property on bogus dataset should fail")
+	}
+}
+
+func TestSetProperty(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// working case
+	if err := z.SetProperty(fs.Name, "compression", "lz4"); err != nil {
+		t.Errorf("unable to set compression on %q, received %+v", fs.Name, err)
+	} else if p, _ := z.GetReceivedProperty(fs.Name, "compression"); p.Value != "lz4" || p.Source != "local" {
+		t.Errorf("compression on %q is %q from %q, expected lz4 from local", fs.Name, p.Value, p.Source)
+	}
+
+	// bogus property case
+	if err := z.SetProperty(fs.Name, "bogus", "bogus"); err == nil {
+		t.Errorf("setting bogus property on %q should fail", fs.Name)
+	}
+}
+
+func TestSetPropertyRecursive(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a child
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	child := Filesystem{Name: fmt.Sprintf("%s/child", fs.Name)}
+	if child, err = z.CreateFilesystem(child); err != nil {
+		t.Errorf("failed to create new filesystem %q", child.Name)
+	}
+
+	// child overrides compression locally
+	if err := z.SetProperty(child.Name, "compression", "off"); err != nil {
+		t.Errorf("unable to set compression on %q, received %+v", child.Name, err)
+	}
+
+	// child should pick up the new value from the parent
+	if err := z.SetPropertyRecursive(fs.Name, "compression", "lz4"); err != nil {
+		t.Errorf("unable to set compression recursively on %q, received %+v", fs.Name, err)
+	} else if p, _ := z.GetReceivedProperty(child.Name, "compression"); p.Value != "lz4" || p.Source == "local" {
+		t.Errorf("compression on %q is %q from %q, expected inherited lz4", child.Name, p.Value, p.Source)
+	}
+}
+
+func TestUserProperties(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// set user properties
+	for property, value := range map[string]string{"user:project": "zfshttpd", "user:owner": "tenant a"} {
+		if err := z.SetProperty(fs.Name, property, value); err != nil {
+			t.Errorf("unable to set %s on %q, received %+v", property, fs.Name, err)
+		}
+	}
+
+	// only user properties are returned
+	props, err := z.UserProperties(fs.Name)
+	if err != nil {
+		t.Errorf("unable to get user properties of %q, received %+v", fs.Name, err)
+	} else {
+		if props["user:project"] != "zfshttpd" || props["user:owner"] != "tenant a" {
+			t.Errorf("user properties of %q are %v", fs.Name, props)
+		}
+		if _, ok := props["compression"]; ok {
+			t.Errorf("native property compression should not be returned")
+		}
+	}
+}
+
+func TestSetProperties(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// working case
+	props := map[string]string{"compression": "lz4", "quota": "1073741824", "user:owner": "tenant a"}
+	if err := z.SetProperties(fs.Name, props); err != nil {
+		t.Errorf("unable to set properties on %q, received %+v", fs.Name, err)
+	}
+	for property, value := range props {
+		if p, _ := z.GetReceivedProperty(fs.Name, property); p.Value != value {
+			t.Errorf("%s on %q is %q, expected %q", property, fs.Name, p.Value, value)
+		}
+	}
+
+	// a bogus property fails the whole set
+	if err := z.SetProperties(fs.Name, map[string]string{"compression": "off", "bogus": "bogus"}); err == nil {
+		t.Errorf("setting bogus property on %q should fail", fs.Name)
+	} else if p, _ := z.GetReceivedProperty(fs.Name, "compression"); p.Value != "lz4" {
+		t.Errorf("compression on %q changed to %q by a failed set", fs.Name, p.Value)
+	}
+
+	// bad property name case
+	if err := z.SetProperties(fs.Name, map[string]string{"a=b": "c"}); err == nil {
+		t.Errorf("setting property with = in its name should fail")
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem without encryption
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	if encrypted, err := z.IsEncrypted(fs.Name); err != nil || encrypted {
+		t.Errorf("filesystem %q should not be encrypted, received %+v", fs.Name, err)
+	}
+
+	// missing dataset case
+	if _, err := z.IsEncrypted(fs.Name + "_bogus"); err == nil {
+		t.Errorf("checking encryption of a missing dataset should fail")
+	}
+}
+
+func TestSetQuota(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// working case
+	if err := z.SetQuota(fs.Name, "1G"); err != nil {
+		t.Errorf("unable to set quota on %q, received %+v", fs.Name, err)
+	} else if fs, _ = z.GetFilesystem(fs.Name); fs.Quota != 1024*1024*1024 {
+		t.Errorf("quota on %q is %d, expected %d", fs.Name, fs.Quota, 1024*1024*1024)
+	}
+
+	// remove the quota
+	if err := z.SetQuota(fs.Name, "none"); err != nil {
+		t.Errorf("unable to remove quota on %q, received %+v", fs.Name, err)
+	} else if fs, _ = z.GetFilesystem(fs.Name); fs.Quota != 0 {
+		t.Errorf("quota on %q is %d, expected none", fs.Name, fs.Quota)
+	}
+
+	// malformed size case
+	if err := z.SetQuota(fs.Name, "1X"); err == nil {
+		t.Errorf("setting malformed quota on %q should fail", fs.Name)
+	}
+}
+
+func TestWrittenSince(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+
+	// written since the snapshot by short name
+	if written, err := z.WrittenSince(fs.Name, snap.ShortName()); err != nil {
+		t.Errorf("unable to get written of %q since %q, received %+v", fs.Name, snap.Name, err)
+	} else {
+		t.Logf("written to %s since %s is %d bytes", fs.Name, snap.ShortName(), written)
+	}
+
+	// snapshot of another filesystem case
+	other := fmt.Sprintf("%s/other@snap", z.Name)
+	if _, err := z.WrittenSince(fs.Name, other); err == nil {
+		t.Errorf("written since snapshot %q of another filesystem should fail", other)
+	}
+}
+
+func TestSnapshotComment(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+
+	// a multi-line comment with quotes round trips
+	comment := "before \"DB\" migration\n\tstep 2"
+	if err := z.SetSnapshotComment(snap.Name, comment); err != nil {
+		t.Errorf("unable to set comment on %q, received %+v", snap.Name, err)
+	}
+	if found, err := z.GetSnapshotComment(snap.Name); err != nil || found != comment {
+		t.Errorf("comment on %q is %q, expected %q, received %+v", snap.Name, found, comment, err)
+	}
+
+	// the comment is on the listed snapshot
+	if l, err := z.ListSnapshots(); err != nil || l[snap.Name] == nil || l[snap.Name].Comment != comment {
+		t.Errorf("listed snapshot %q should have comment %q, received %+v", snap.Name, comment, err)
+	}
+
+	// an empty comment removes it
+	if err := z.SetSnapshotComment(snap.Name, ""); err != nil {
+		t.Errorf("unable to remove comment on %q, received %+v", snap.Name, err)
+	}
+	if found, err := z.GetSnapshotComment(snap.Name); err != nil || len(found) > 0 {
+		t.Errorf("comment on %q should be removed, found %q, received %+v", snap.Name, found, err)
+	}
+
+	// a comment on the filesystem isn't inherited by its snapshots
+	if err := z.SetProperty(fs.Name, commentProperty, "filesystem comment"); err != nil {
+		t.Errorf("unable to set comment on %q, received %+v", fs.Name, err)
+	}
+	if found, err := z.GetSnapshotComment(snap.Name); err != nil || len(found) > 0 {
+		t.Errorf("snapshot %q should not inherit the comment of %q, found %q, received %+v", snap.Name, fs.Name, found, err)
+	}
+	if l, err := z.ListSnapshots(); err != nil || l[snap.Name] == nil || len(l[snap.Name].Comment) > 0 {
+		t.Errorf("listed snapshot %q should not inherit the comment of %q, received %+v", snap.Name, fs.Name, err)
+	}
+
+	// filesystem instead of snapshot case
+	if err := z.SetSnapshotComment(fs.Name, comment); err == nil {
+		t.Errorf("setting comment on filesystem %q should fail", fs.Name)
+	}
+}
+
+func TestEscapeComment(t *testing.T) {
+
+	for _, comment := range []string{"plain", "tab\there", "new\nline", `back\slash "quoted"`, "ünïcode"} {
+		escaped := escapeComment(comment)
+		if strings.ContainsAny(escaped, "\t\n") {
+			t.Errorf("escaped comment %q should be a single line without tabs", escaped)
+		}
+		if unescaped := unescapeComment(escaped); unescaped != comment {
+			t.Errorf("comment %q round trips to %q", comment, unescaped)
+		}
+	}
+
+	// a value set outside the package is returned as is
+	if value := unescapeComment(`bad "quote`); value != `bad "quote` {
+		t.Errorf("value %q should be returned as is, found %q", `bad "quote`, value)
+	}
+}
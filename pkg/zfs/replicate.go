@@ -0,0 +1,287 @@
+package zfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrUpToDate is returned when a replication target already has the latest snapshot.
+var ErrUpToDate = errors.New("target is up to date")
+
+// RemoteTarget is a dataset on a remote host reachable with ssh.
+type RemoteTarget struct {
+	Host    string
+	User    string // optional, defaults to the ssh configuration
+	Port    int    // optional, defaults to the ssh configuration
+	Dataset string
+}
+
+// command returns an ssh command running the zfs args on the remote host with LC_ALL=C.
+func (t RemoteTarget) command(args ...string) *exec.Cmd {
+	sshArgs := make([]string, 0)
+	if t.Port != 0 {
+		sshArgs = append(sshArgs, "-p", fmt.Sprint(t.Port))
+	}
+	host := t.Host
+	if len(t.User) != 0 {
+		host = t.User + "@" + host
+	}
+	sshArgs = append(append(sshArgs, host, "LC_ALL=C", "zfs"), args...)
+	return exec.Command("ssh", sshArgs...)
+}
+
+// remoteNameRE matches the dataset names passed to the remote shell, which ssh doesn't quote.
+var remoteNameRE = regexp.MustCompile(`^[A-Za-z0-9_.:/-]+$`)
+
+// Replicate sends the latest snapshot of the filesystem to the remote target over ssh.
+// An incremental stream is sent from the newest snapshot the target already has, matched by GUID, otherwise a full stream is sent.
+func (z Zpool) Replicate(filesystem string, target RemoteTarget) error {
+
+	// the dataset is interpreted by the remote shell and the host must not be taken for an ssh option
+	if len(target.Host) == 0 || strings.HasPrefix(target.Host, "-") || !remoteNameRE.MatchString(target.Dataset) {
+		return errors.Errorf("bad remote target %q on host %q", target.Dataset, target.Host)
+	}
+
+	// zfs list -H -t snapshot -o guid -d 1 tank/a on the remote host
+	cmd := target.command("list", "-H", "-t", "snapshot", "-o", "guid", "-d", "1", target.Dataset)
+	out, err := execAndLog(cmd)
+	remoteGUIDs := make([]string, 0)
+	if err != nil {
+		// a missing target dataset gets a full stream
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok || strings.Contains(string(exitErr.Stderr), "dataset does not exist") == false {
+			cmdString := getCommandString(cmd)
+			return errors.Wrapf(err, "unable to run command %q", cmdString)
+		}
+	} else if trimmed := strings.TrimSpace(string(out)); len(trimmed) > 0 {
+		remoteGUIDs = strings.Split(trimmed, "\n")
+	}
+
+	// an up to date target doesn't start a receive
+	base, latest, err := z.replicationPlan(filesystem, remoteGUIDs)
+	if err != nil {
+		return err
+	}
+
+	// zfs receive -F tank/a on the remote host, -F rolls back changes made on the target since the base snapshot
+	args := []string{"receive", target.Dataset}
+	if base != nil {
+		args = []string{"receive", "-F", target.Dataset}
+	}
+	var stderr bytes.Buffer
+	cmd = target.command(args...)
+	cmd.Stderr = &stderr
+
+	// writes fail once the remote receive exits, so an early exit doesn't block the send
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// stream into the remote receive, closing stdin ends the stream
+	sendErr := z.sendPlan(base, latest, stdin)
+	stdin.Close()
+
+	err = cmd.Wait()
+	logCommand(cmd, time.Since(start))
+	if err != nil {
+		// the receive failing is the cause of a broken send
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q: %s", cmdString, strings.TrimSpace(stderr.String()))
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+
+	return nil
+}
+
+// ReplicateTo writes a send stream of the latest snapshot of the filesystem to w, for a target having the snapshots with remoteGUIDs.
+// An incremental stream is written from the newest snapshot in remoteGUIDs, otherwise a full stream is written.
+func (z Zpool) ReplicateTo(filesystem string, remoteGUIDs []string, w io.Writer) error {
+
+	base, latest, err := z.replicationPlan(filesystem, remoteGUIDs)
+	if err != nil {
+		return err
+	}
+
+	return z.sendPlan(base, latest, w)
+}
+
+// replicationPlan returns the latest snapshot of the filesystem and the incremental base for a target having the
+// snapshots with remoteGUIDs, nil for a full stream. ErrUpToDate is returned when the target has the latest snapshot.
+func (z Zpool) replicationPlan(filesystem string, remoteGUIDs []string) (base, latest *Snapshot, err error) {
+
+	l, err := z.SnapshotsOf(Filesystem{Name: filesystem})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(l) == 0 {
+		return nil, nil, errors.Errorf("filesystem %q has no snapshots to replicate", filesystem)
+	}
+
+	// order snapshots from oldest to newest
+	sortByCreateTxg(l)
+	latest = l[len(l)-1]
+
+	// the newest snapshot the target has is the incremental base
+	base, ok := newestWithGUID(l, remoteGUIDs)
+	if !ok {
+		return nil, latest, nil
+	}
+	if base.Name == latest.Name {
+		return nil, nil, errors.Wrapf(ErrUpToDate, "target already has latest snapshot %q", latest.Name)
+	}
+	return base, latest, nil
+}
+
+// sendPlan writes the stream of a replication plan to w, incremental from base when it isn't nil.
+func (z Zpool) sendPlan(base, latest *Snapshot, w io.Writer) error {
+	if base != nil {
+		return z.SendIncremental(base.Name, latest.Name, w, SendOptions{})
+	}
+	return z.Send(latest.Name, w, SendOptions{})
+}
+
+// IncrementalBase returns the snapshot of the filesystem with the highest createtxg whose GUID is in remoteGUIDs,
+// the base to send an incremental stream from to a target having those snapshots. Matching by GUID finds the
+// base even when the snapshot was renamed on either side. The bool is false when no snapshot matches.
+func (z Zpool) IncrementalBase(filesystem string, remoteGUIDs []string) (Snapshot, bool, error) {
+
+	l, err := z.SnapshotsOf(Filesystem{Name: filesystem})
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	base, ok := newestWithGUID(l, remoteGUIDs)
+	if !ok {
+		return Snapshot{}, false, nil
+	}
+	return *base, true, nil
+}
+
+// UnreplicatedSnapshots returns the snapshots of the filesystem whose GUID isn't in remoteGUIDs, the snapshots a target
+// having those GUIDs is missing, sorted by createtxg oldest first. Matching by GUID finds the snapshots a target has
+// even when they were renamed on either side.
+func (z Zpool) UnreplicatedSnapshots(filesystem string, remoteGUIDs map[string]bool) ([]*Snapshot, error) {
+
+	unreplicated := make([]*Snapshot, 0)
+
+	// short circuit to error if the filesystem isn't on the zpool
+	if len(filesystem) == 0 || !z.owns(filesystem) || strings.ContainsAny(filesystem, "@#") {
+		return unreplicated, errors.Errorf("bad request for snapshots of %q on zpool %q", filesystem, z.Name)
+	}
+
+	groups, err := z.SnapshotsOfMany([]string{filesystem})
+	if err != nil {
+		return unreplicated, err
+	}
+
+	// groups are sorted by createtxg
+	for _, snap := range groups[filesystem] {
+		if !remoteGUIDs[snap.GUID] {
+			unreplicated = append(unreplicated, snap)
+		}
+	}
+
+	return unreplicated, nil
+}
+
+// newestWithGUID returns the snapshot with the highest createtxg whose GUID is in guids.
+func newestWithGUID(snapshots []*Snapshot, guids []string) (*Snapshot, bool) {
+
+	set := make(map[string]bool)
+	for _, guid := range guids {
+		set[guid] = true
+	}
+
+	var newest *Snapshot
+	for _, snap := range snapshots {
+		if set[snap.GUID] && (newest == nil || snap.CreateTxg > newest.CreateTxg) {
+			newest = snap
+		}
+	}
+
+	return newest, newest != nil
+}
+
+// CommonSnapshot returns the GUID of the newest snapshot of fsA, by createtxg, that also exists on fsB.
+// Snapshots are matched by GUID, which is preserved by send and receive and doesn't change on rename.
+// The bool is false when the filesystems have no snapshot in common.
+func (z Zpool) CommonSnapshot(fsA, fsB string) (string, bool, error) {
+
+	a, err := z.SnapshotsOf(Filesystem{Name: fsA})
+	if err != nil {
+		return "", false, err
+	}
+
+	b, err := z.SnapshotsOf(Filesystem{Name: fsB})
+	if err != nil {
+		return "", false, err
+	}
+
+	guids := make([]string, 0, len(b))
+	for _, snap := range b {
+		guids = append(guids, snap.GUID)
+	}
+
+	newest, ok := newestWithGUID(a, guids)
+	if !ok {
+		return "", false, nil
+	}
+	return newest.GUID, true, nil
+}
+
+// SnapshotDrift compares the snapshots of the filesystem on the zpool with the filesystem of the same name on the
+// other zpool, such as a replica, by GUID so renamed snapshots still match. It returns the names of the snapshots
+// missing on the other zpool and the names of the snapshots only the other zpool has, oldest first.
+func (z Zpool) SnapshotDrift(other Zpool, filesystem string) (missingOnOther, extraOnOther []string, err error) {
+
+	missingOnOther, extraOnOther = make([]string, 0), make([]string, 0)
+
+	// the filesystem name is relative to each zpool
+	otherFilesystem := other.Name + strings.TrimPrefix(filesystem, z.Name)
+	if !z.owns(filesystem) {
+		return missingOnOther, extraOnOther, errors.Errorf("bad request for filesystem %q on zpool %q", filesystem, z.Name)
+	}
+
+	local, err := z.SnapshotsOf(Filesystem{Name: filesystem})
+	if err != nil {
+		return missingOnOther, extraOnOther, err
+	}
+	remote, err := other.SnapshotsOf(Filesystem{Name: otherFilesystem})
+	if err != nil {
+		return missingOnOther, extraOnOther, err
+	}
+
+	// names of the snapshots whose guid isn't in the other set, ordered by createtxg
+	diff := func(a, b []*Snapshot) []string {
+		guids := make(map[string]bool)
+		for _, snap := range b {
+			guids[snap.GUID] = true
+		}
+		sortByCreateTxg(a)
+		names := make([]string, 0)
+		for _, snap := range a {
+			if !guids[snap.GUID] {
+				names = append(names, snap.Name)
+			}
+		}
+		return names
+	}
+
+	return diff(local, remote), diff(remote, local), nil
+}
@@ -0,0 +1,225 @@
+package zfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func TestReplicateTo(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// no snapshots case
+	if err := z.ReplicateTo(fs.Name, nil, &bytes.Buffer{}); err == nil {
+		t.Errorf("replicating %q without snapshots should fail", fs.Name)
+	}
+
+	// create 2 snapshots on the new filesystem
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 2; i++ {
+		snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+		snap, err := z.CreateSnapshot(snapName)
+		if err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	// full stream into a new filesystem
+	name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+	var full bytes.Buffer
+	if err := z.ReplicateTo(fs.Name, nil, &full); err != nil {
+		t.Errorf("unable to replicate %q, received %+v", fs.Name, err)
+	} else if err := z.Receive(name, &full, ReceiveOptions{ExpectedGUID: snaps[1].GUID}); err != nil {
+		t.Errorf("unable to receive full stream into %q, received %+v", name, err)
+	}
+
+	// incremental stream from the first snapshot
+	var incremental bytes.Buffer
+	if err := z.ReplicateTo(fs.Name, []string{snaps[0].GUID}, &incremental); err != nil {
+		t.Errorf("unable to replicate %q from %q, received %+v", fs.Name, snaps[0].Name, err)
+	} else if incremental.Len() == 0 {
+		t.Errorf("incremental stream of %q is empty", fs.Name)
+	}
+
+	// up to date case
+	if err := z.ReplicateTo(fs.Name, []string{snaps[1].GUID}, &bytes.Buffer{}); errors.Cause(err) != ErrUpToDate {
+		t.Errorf("replicating %q to an up to date target should fail with %v, received %+v", fs.Name, ErrUpToDate, err)
+	}
+}
+
+func TestReplicateBadTarget(t *testing.T) {
+	needsZpool(t)
+
+	// targets rejected before running ssh
+	targets := []RemoteTarget{
+		{Host: "backup", Dataset: "tank/a; rm -rf /"},
+		{Host: "backup", Dataset: "tank/$(id)"},
+		{Host: "-oProxyCommand=id", Dataset: "tank/a"},
+		{Host: "backup"},
+	}
+	for _, target := range targets {
+		if err := z.Replicate(z.Name, target); err == nil {
+			t.Errorf("replicating to target %+v should fail", target)
+		}
+	}
+}
+
+func TestCommonSnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot and replicate it to a new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+	name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+	var buf bytes.Buffer
+	if err := z.Send(snap.Name, &buf, SendOptions{}); err != nil {
+		t.Errorf("unable to send %q, received %+v", snap.Name, err)
+	}
+	if err := z.Receive(name, &buf, ReceiveOptions{}); err != nil {
+		t.Errorf("unable to receive %q, received %+v", name, err)
+	}
+
+	// the sent snapshot is common
+	if guid, ok, err := z.CommonSnapshot(fs.Name, name); err != nil || !ok || guid != snap.GUID {
+		t.Errorf("common snapshot of %q and %q is %q, expected %q, received %+v", fs.Name, name, guid, snap.GUID, err)
+	}
+
+	// no common snapshot case
+	if _, ok, err := z.CommonSnapshot(fs.Name, z.Name); err != nil || ok {
+		t.Errorf("%q and %q should have no common snapshot, received %+v", fs.Name, z.Name, err)
+	}
+}
+
+func TestIncrementalBase(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 3 snapshots on the new filesystem
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 3; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	// the newest matching snapshot is the base, regardless of the order of the guids
+	if base, ok, err := z.IncrementalBase(fs.Name, []string{snaps[1].GUID, "1", snaps[0].GUID}); err != nil || !ok || base.GUID != snaps[1].GUID {
+		t.Errorf("incremental base of %q is %q, expected %q, received %+v", fs.Name, base.Name, snaps[1].Name, err)
+	}
+
+	// no matching snapshot case
+	if _, ok, err := z.IncrementalBase(fs.Name, []string{"1"}); err != nil || ok {
+		t.Errorf("%q should have no incremental base, received %+v", fs.Name, err)
+	}
+}
+
+func TestUnreplicatedSnapshots(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 3 snapshots on the new filesystem
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 3; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	// the target has the middle snapshot
+	l, err := z.UnreplicatedSnapshots(fs.Name, map[string]bool{snaps[1].GUID: true})
+	if err != nil {
+		t.Errorf("unable to get unreplicated snapshots of %q, received %+v", fs.Name, err)
+	} else if len(l) != 2 || l[0].GUID != snaps[0].GUID || l[1].GUID != snaps[2].GUID {
+		t.Errorf("unreplicated snapshots of %q should be %q and %q, found %+v", fs.Name, snaps[0].Name, snaps[2].Name, l)
+	}
+
+	// empty target case
+	if l, err := z.UnreplicatedSnapshots(fs.Name, nil); err != nil || len(l) != 3 {
+		t.Errorf("all 3 snapshots of %q should be unreplicated, found %d, received %+v", fs.Name, len(l), err)
+	}
+}
+
+func TestSnapshotDrift(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a snapshot and replicate it to a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+	var buf bytes.Buffer
+	if err := z.Send(snap.Name, &buf, SendOptions{}); err != nil {
+		t.Errorf("unable to send %q, received %+v", snap.Name, err)
+	}
+	if err := z.Receive(name, &buf, ReceiveOptions{}); err != nil {
+		t.Errorf("unable to receive %q, received %+v", name, err)
+	}
+
+	// a newer snapshot on the source, the replica is behind by one
+	newer, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+
+	// only one zpool is available, so treat the source and the replica as the roots of two zpools
+	root := Zpool{Name: fs.Name}
+	replica := Zpool{Name: name}
+	missing, extra, err := root.SnapshotDrift(replica, fs.Name)
+	if err != nil {
+		t.Errorf("unable to compare %q and %q, received %+v", fs.Name, name, err)
+	} else if len(missing) != 1 || missing[0] != newer.Name || len(extra) != 0 {
+		t.Errorf("drift of %q is missing %v and extra %v, expected missing %q", name, missing, extra, newer.Name)
+	}
+}
@@ -0,0 +1,80 @@
+package zfs
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionProperty is the user property holding the retention of a filesystem's snapshots, such as 30d.
+const retentionProperty = "user:retention"
+
+// SnapshotsPastRetention returns the snapshots older than the retention of their filesystem, grouped by filesystem
+// and sorted by createtxg. The retention is read from the user:retention property, which children inherit.
+// Filesystems without the property are skipped, an unparseable retention is an error.
+func (z Zpool) SnapshotsPastRetention() (expired map[string][]*Snapshot, err error) {
+
+	expired = make(map[string][]*Snapshot)
+
+	l, err := z.ListFilesystemsProps([]string{retentionProperty})
+	if err != nil {
+		return expired, err
+	}
+
+	// filesystems with a retention
+	retentions := make(map[string]time.Duration)
+	names := make([]string, 0)
+	for name, fs := range l {
+		value := fs.Properties[retentionProperty]
+		if len(value) == 0 || value == "-" {
+			continue
+		}
+		retention, err := parseRetention(value)
+		if err != nil {
+			return expired, errors.Wrapf(err, "bad %s on filesystem %q", retentionProperty, name)
+		}
+		retentions[name] = retention
+		names = append(names, name)
+	}
+
+	groups, err := z.SnapshotsOfMany(names)
+	if err != nil {
+		return expired, err
+	}
+
+	now := time.Now()
+	for name, snapshots := range groups {
+		for _, snap := range snapshots {
+			if now.Sub(snap.Creation) > retentions[name] {
+				expired[name] = append(expired[name], snap)
+			}
+		}
+	}
+
+	return expired, nil
+}
+
+// parseRetention parses a retention such as 30d, 2w or any time.ParseDuration value like 12h.
+func parseRetention(value string) (time.Duration, error) {
+
+	// days and weeks aren't understood by time.ParseDuration
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, err := strconv.ParseInt(strings.TrimSuffix(value, suffix), 10, 64); err == nil && strings.HasSuffix(value, suffix) {
+			if n <= 0 {
+				return 0, errors.Errorf("retention %q must be positive", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Errorf("unable to parse retention %q", value)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("retention %q must be positive", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,71 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+
+	cases := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"90m": 90 * time.Minute,
+	}
+	for value, expected := range cases {
+		if d, err := parseRetention(value); err != nil || d != expected {
+			t.Errorf("retention %q parsed as %s, expected %s, received %+v", value, d, expected, err)
+		}
+	}
+
+	// bad retention cases
+	for _, value := range []string{"", "d", "thirty days", "0d", "-1h"} {
+		if _, err := parseRetention(value); err == nil {
+			t.Errorf("parsing retention %q should fail", value)
+		}
+	}
+}
+
+func TestSnapshotsPastRetention(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a snapshot and a retention that has already passed
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	if err := z.SetProperty(fs.Name, retentionProperty, "1s"); err != nil {
+		t.Errorf("unable to set %s on %q, received %+v", retentionProperty, fs.Name, err)
+	}
+	time.Sleep(2 * time.Second)
+
+	expired, err := z.SnapshotsPastRetention()
+	if err != nil {
+		t.Errorf("unable to get snapshots past retention, received %+v", err)
+	} else if len(expired[fs.Name]) != 1 || expired[fs.Name][0].Name != snap.Name {
+		t.Errorf("snapshot %q should be past retention, found %v", snap.Name, expired[fs.Name])
+	}
+
+	// a long retention keeps the snapshot
+	if err := z.SetProperty(fs.Name, retentionProperty, "30d"); err != nil {
+		t.Errorf("unable to set %s on %q, received %+v", retentionProperty, fs.Name, err)
+	}
+	if expired, err := z.SnapshotsPastRetention(); err != nil || len(expired[fs.Name]) != 0 {
+		t.Errorf("snapshot %q should be within retention, received %+v", snap.Name, err)
+	}
+
+	// inherit the property again so other tests aren't affected
+	if err := z.InheritProperty(fs.Name, retentionProperty, false); err != nil {
+		t.Errorf("unable to inherit %s on %q, received %+v", retentionProperty, fs.Name, err)
+	}
+}
@@ -0,0 +1,145 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ScrubStatus is the state of the last scrub or resilver of the zpool, from the scan line of `zpool status`.
+type ScrubStatus struct {
+	Function   string `json:"function"` // scrub or resilver, empty when no scan was requested
+	InProgress bool   `json:"inProgress"`
+	Canceled   bool   `json:"canceled"`
+	Repaired   int64  `json:"repaired"` // bytes
+	Errors     int64  `json:"errors"`
+}
+
+// Scrub starts a scrub of the zpool, it returns once the scrub is started.
+func (z Zpool) Scrub() error {
+
+	// zpool scrub tank
+	cmd := command(zpoolPath, "scrub", z.Name)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. scrub or resilver already in progress
+		// 2. zpool fails
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
+
+// ScrubStatus returns the status of the last scrub or resilver of the zpool.
+func (z Zpool) ScrubStatus() (s ScrubStatus, err error) {
+
+	// zpool status tank
+	cmd := command(zpoolPath, "status", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return s, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return parseScrubStatus(out)
+}
+
+// WaitForScrub polls ScrubStatus every poll interval until no scrub or resilver is in progress, and returns the final status.
+// It returns the context error when the context is done first.
+func (z Zpool) WaitForScrub(ctx context.Context, poll time.Duration) (s ScrubStatus, err error) {
+
+	if poll <= 0 {
+		return s, errors.Errorf("bad poll interval %s", poll)
+	}
+
+	for {
+		s, err = z.ScrubStatus()
+		if err != nil || !s.InProgress {
+			return s, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return s, errors.Wrapf(ctx.Err(), "scrub of zpool %q still in progress", z.Name)
+		case <-time.After(poll):
+		}
+	}
+}
+
+var (
+	scanRepairedRE = regexp.MustCompile(`repaired (\S+)`)
+	scanProgressRE = regexp.MustCompile(`(\S+) repaired,`)
+	scanErrorsRE   = regexp.MustCompile(`with (\d+) errors`)
+)
+
+// parseScrubStatus parses the scan line of `zpool status` output, along with its continuation lines.
+func parseScrubStatus(out []byte) (s ScrubStatus, err error) {
+
+	// zpool status example
+	//   scan: scrub repaired 0B in 00:00:01 with 0 errors on Sun Oct 17 06:00:01 2026
+	//   scan: scrub in progress since Sun Oct 17 06:00:01 2026
+	// 	1.23G scanned at 100M/s, 1.00G issued at 80M/s, 10.0G total
+	// 	0B repaired, 10.00% done, 00:01:52 to go
+	//   scan: resilvered 1.50G in 00:00:05 with 0 errors on Sun Oct 17 06:00:01 2026
+	//   scan: scrub canceled on Sun Oct 17 06:00:01 2026
+	//   scan: none requested
+	var scan []string
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		if strings.HasPrefix(line, "scan:") {
+			scan = append(scan, strings.TrimSpace(strings.TrimPrefix(line, "scan:")))
+			continue
+		}
+		// continuation lines are indented and have no "key:" prefix
+		if len(scan) > 0 {
+			if len(line) == 0 || !strings.HasPrefix(in.Text(), "\t") || strings.HasSuffix(strings.Fields(line)[0], ":") {
+				break
+			}
+			scan = append(scan, line)
+		}
+	}
+	if len(scan) == 0 {
+		return s, errors.Errorf("unable to find scan status in zpool status output")
+	}
+
+	text := strings.Join(scan, " ")
+	switch {
+	case strings.HasPrefix(text, "none requested"):
+		return s, nil
+	case strings.HasPrefix(text, "scrub"):
+		s.Function = "scrub"
+	case strings.HasPrefix(text, "resilver"):
+		s.Function = "resilver"
+	default:
+		return s, errors.Errorf("unable to parse scan status %q", text)
+	}
+	s.InProgress = strings.Contains(text, "in progress")
+	s.Canceled = strings.Contains(text, "canceled")
+
+	// repaired bytes is reported before the duration when finished, and in the progress line when in progress
+	// resilvered reports the resilvered bytes, not repairs
+	if m := scanProgressRE.FindStringSubmatch(text); m != nil {
+		s.Repaired, err = parseReportedSize(m[1])
+	} else if m := scanRepairedRE.FindStringSubmatch(text); m != nil {
+		s.Repaired, err = parseReportedSize(m[1])
+	}
+	if err != nil {
+		return s, err
+	}
+
+	if m := scanErrorsRE.FindStringSubmatch(text); m != nil {
+		s.Errors, err = parseInt("errors", m[1])
+	}
+
+	return s, err
+}
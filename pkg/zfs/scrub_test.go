@@ -0,0 +1,72 @@
+package zfs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseScrubStatus(t *testing.T) {
+
+	cases := []struct {
+		out    string
+		status ScrubStatus
+	}{
+		{
+			out:    "  pool: tank\n state: ONLINE\n  scan: none requested\nconfig:\n",
+			status: ScrubStatus{},
+		},
+		{
+			out:    "  pool: tank\n state: ONLINE\n  scan: scrub repaired 1.50K in 00:00:01 with 2 errors on Sun Oct 17 06:00:01 2026\nconfig:\n",
+			status: ScrubStatus{Function: "scrub", Repaired: 1536, Errors: 2},
+		},
+		{
+			out:    "  pool: tank\n state: ONLINE\n  scan: scrub in progress since Sun Oct 17 06:00:01 2026\n\t1.23G scanned at 100M/s, 1.00G issued at 80M/s, 10.0G total\n\t512B repaired, 10.00% done, 00:01:52 to go\nconfig:\n",
+			status: ScrubStatus{Function: "scrub", InProgress: true, Repaired: 512},
+		},
+		{
+			out:    "  pool: tank\n state: ONLINE\n  scan: resilvered 1.50G in 00:00:05 with 0 errors on Sun Oct 17 06:00:01 2026\nconfig:\n",
+			status: ScrubStatus{Function: "resilver"},
+		},
+		{
+			out:    "  pool: tank\n state: ONLINE\n  scan: scrub canceled on Sun Oct 17 06:00:01 2026\nconfig:\n",
+			status: ScrubStatus{Function: "scrub", Canceled: true},
+		},
+	}
+
+	for _, c := range cases {
+		s, err := parseScrubStatus([]byte(c.out))
+		if err != nil {
+			t.Errorf("unable to parse scan status %q, received %+v", c.out, err)
+		} else if s != c.status {
+			t.Errorf("parsed scan status %+v, expected %+v", s, c.status)
+		}
+	}
+}
+
+func TestWaitForScrub(t *testing.T) {
+	needsZpool(t)
+
+	// start a scrub
+	if err := z.Scrub(); err != nil {
+		t.Errorf("unable to scrub %s, received %+v", z.Name, err)
+	}
+
+	// wait for the scrub to finish
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	s, err := z.WaitForScrub(ctx, time.Second)
+	if err != nil {
+		t.Errorf("unable to wait for scrub of %s, received %+v", z.Name, err)
+	} else {
+		t.Logf("zpool %s %s finished, repaired: %d, errors: %d\n", z.Name, s.Function, s.Repaired, s.Errors)
+		if s.InProgress || s.Function != "scrub" {
+			t.Errorf("zpool %s scrub should be finished, received %+v", z.Name, s)
+		}
+	}
+
+	// bad poll interval case
+	if _, err := z.WaitForScrub(ctx, 0); err == nil {
+		t.Errorf("waiting with a zero poll interval should fail")
+	}
+}
@@ -0,0 +1,601 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SendOptions are the flags passed to `zfs send`.
+type SendOptions struct {
+	// Raw sends the data exactly as it exists on disk (-w), which preserves encryption.
+	// Raw sends are required to replicate encrypted datasets without loading their keys.
+	// Introduced in OpenZFS 0.8.0.
+	Raw bool
+
+	// Compressed sends compressed blocks without decompressing them first (-c).
+	// A raw send already carries blocks as stored, so combined with Raw it changes nothing.
+	// Introduced in OpenZFS 0.7.0.
+	Compressed bool
+
+	// Replicate sends the snapshot's filesystem and all descendant filesystems with their snapshots, clones and
+	// properties (-R), to seed a new replication target with the whole tree. The snapshot must exist on every
+	// descendant, as created by a recursive snapshot. With SendIncremental the stream holds the changes of the
+	// whole tree between the two snapshots, and descendants created since the from snapshot are sent in full.
+	Replicate bool
+
+	// BandwidthLimit caps the rate the stream is written at in bytes per second, zero means unlimited.
+	// zfs send has no throttle of its own, so the limit is applied to the writer.
+	BandwidthLimit int64
+
+	// Progress is called with the number of bytes written so far, as the stream is written.
+	Progress func(bytesDone int64)
+}
+
+// args returns the `zfs send` flags for the options.
+func (o SendOptions) args() ([]string, error) {
+
+	if o.BandwidthLimit < 0 {
+		return nil, errors.Errorf("bandwidth limit %d must not be negative", o.BandwidthLimit)
+	}
+
+	args := make([]string, 0)
+	if o.Raw {
+		args = append(args, "-w")
+	}
+	if o.Compressed {
+		args = append(args, "-c")
+	}
+	if o.Replicate {
+		args = append(args, "-R")
+	}
+
+	return args, nil
+}
+
+// writer wraps w with the bandwidth limit and progress callback of the options.
+func (o SendOptions) writer(w io.Writer) io.Writer {
+	if o.BandwidthLimit > 0 {
+		w = newLimitedWriter(w, o.BandwidthLimit)
+	}
+	if o.Progress != nil {
+		w = &progressWriter{w: w, progress: o.Progress}
+	}
+	return w
+}
+
+// Send writes a full send stream of the snapshot to w.
+func (z Zpool) Send(snapshot string, w io.Writer, opts SendOptions) error {
+	return z.SendContext(context.Background(), snapshot, w, opts)
+}
+
+// SnapshotAndSend snapshots the filesystem with a name from SnapshotName and writes a full send stream of it to w,
+// returning the created snapshot. The snapshot is destroyed when the send fails, so a failed backup leaves nothing behind.
+func (z *Zpool) SnapshotAndSend(filesystem, snapLabel string, w io.Writer) (Snapshot, error) {
+
+	// short circuit to error if the filesystem isn't on the zpool
+	if len(filesystem) == 0 || !z.owns(filesystem) || strings.ContainsAny(filesystem, "@#") {
+		return Snapshot{}, errors.Errorf("bad request for snapshot of %q on zpool %q", filesystem, z.Name)
+	}
+
+	snap, err := z.CreateUniqueSnapshot(SnapshotName(filesystem, snapLabel))
+	if err != nil {
+		return snap, err
+	}
+
+	if err := z.Send(snap.Name, w, SendOptions{}); err != nil {
+		if derr := z.DestroySnapshot(snap.Name); derr != nil {
+			return snap, errors.Wrapf(err, "unable to send snapshot %q, nor destroy it: %v", snap.Name, derr)
+		}
+		return Snapshot{}, errors.Wrapf(err, "unable to send snapshot %q", snap.Name)
+	}
+
+	return snap, nil
+}
+
+// SendContext writes a full send stream of the snapshot to w.
+// The `zfs send` process and its children are killed when the context is cancelled or a write to w fails.
+func (z Zpool) SendContext(ctx context.Context, snapshot string, w io.Writer, opts SendOptions) error {
+
+	// snapshot name should start with zpool name
+	if strings.Contains(snapshot, "@") == false || !z.owns(snapshot) {
+		return errors.Errorf("bad request for snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	// a replication stream is sent from a snapshot of the tree's root filesystem
+	if opts.Replicate && !isReplicationSource(snapshot) {
+		return errors.Errorf("bad request for replication of snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+
+	// zfs send -w tank/a@snap
+	args = append(append([]string{"send"}, args...), snapshot)
+	return z.send(ctx, args, opts.writer(w))
+}
+
+// SendIncremental writes an incremental send stream between the from and to snapshots to w.
+func (z Zpool) SendIncremental(from, to string, w io.Writer, opts SendOptions) error {
+	return z.SendIncrementalContext(context.Background(), from, to, w, opts)
+}
+
+// SendIncrementalContext writes an incremental send stream between the from and to snapshots to w.
+// The `zfs send` process and its children are killed when the context is cancelled or a write to w fails.
+func (z Zpool) SendIncrementalContext(ctx context.Context, from, to string, w io.Writer, opts SendOptions) error {
+
+	// snapshot names should start with zpool name
+	for _, name := range []string{from, to} {
+		if strings.Contains(name, "@") == false || !z.owns(name) {
+			return errors.Errorf("bad request for snapshot %q on zpool %q", name, z.Name)
+		}
+	}
+
+	// a replication stream is sent between two snapshots of the tree's root filesystem
+	if opts.Replicate {
+		if !isReplicationSource(from) || !isReplicationSource(to) || strings.Split(from, "@")[0] != strings.Split(to, "@")[0] {
+			return errors.Errorf("bad request for replication from %q to %q on zpool %q", from, to, z.Name)
+		}
+	}
+
+	args, err := opts.args()
+	if err != nil {
+		return err
+	}
+
+	// zfs send -w -i tank/a@snap1 tank/a@snap2
+	args = append(append([]string{"send"}, args...), "-i", from, to)
+	return z.send(ctx, args, opts.writer(w))
+}
+
+// isReplicationSource reports whether the name is a snapshot `zfs send -R` can replicate a tree from,
+// one filesystem and snapshot name, not a bookmark.
+func isReplicationSource(name string) bool {
+	filesystem, snap, found := strings.Cut(name, "@")
+	return found && len(filesystem) > 0 && len(snap) > 0 && !strings.ContainsAny(name, "#%") && !strings.Contains(snap, "@")
+}
+
+// send runs `zfs send` with the args, streaming its output to w.
+// The command runs in its own process group, which is killed when the context is done or writing to w fails.
+func (z Zpool) send(ctx context.Context, args []string, w io.Writer) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// build command in its own process group
+	var stderr bytes.Buffer
+	cmd := commandContext(ctx, zfsPath, args...)
+	cmd.Env = z.environ()
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmdString := getCommandString(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// run command
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// a failed write kills the command, otherwise it would block on a full pipe
+	_, copyErr := io.Copy(w, stdout)
+	if copyErr != nil {
+		cancel()
+	}
+
+	err = cmd.Wait()
+	logCommand(cmd, time.Since(start))
+	switch {
+	case copyErr != nil:
+		return errors.Wrapf(copyErr, "unable to write output of command %q", cmdString)
+	case ctx.Err() != nil && err != nil:
+		return errors.Wrapf(ctx.Err(), "command %q was cancelled", cmdString)
+	case err != nil:
+		return errors.Wrapf(err, "unable to run command %q: %s", cmdString, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// ErrGUIDMismatch is returned when a received dataset doesn't have the expected GUID.
+var ErrGUIDMismatch = errors.New("guid mismatch")
+
+// ReceiveOptions are the options of `zfs receive`.
+type ReceiveOptions struct {
+	// ExpectedGUID is the GUID of the snapshot on the sending side, checked after the receive when not empty.
+	// Snapshot GUIDs are preserved by send and receive, filesystem GUIDs are not.
+	ExpectedGUID string
+
+	// Progress is called with the number of bytes read so far, as the stream is received.
+	Progress func(bytesDone int64)
+}
+
+// Receive reads a send stream from r into the dataset.
+// When the dataset is a snapshot its GUID must match the expected GUID, when it is a filesystem one of its snapshots must match.
+func (z Zpool) Receive(dataset string, r io.Reader, opts ReceiveOptions) error {
+
+	// dataset name should start with zpool name
+	if len(dataset) == 0 || !z.owns(dataset) {
+		return errors.Errorf("bad request for dataset %q on zpool %q", dataset, z.Name)
+	}
+
+	// zfs receive tank/a
+	var stderr bytes.Buffer
+	cmd := command(zfsPath, "receive", dataset)
+	cmd.Env = z.environ()
+	cmd.Stdin = r
+	cmd.Stderr = &stderr
+	if opts.Progress != nil {
+		cmd.Stdin = &progressReader{r: r, progress: opts.Progress}
+	}
+
+	// run command
+	start := time.Now()
+	err := cmd.Run()
+	logCommand(cmd, time.Since(start))
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q: %s", cmdString, strings.TrimSpace(stderr.String()))
+	}
+
+	if len(opts.ExpectedGUID) == 0 {
+		return nil
+	}
+
+	return z.verifyReceived(dataset, opts.ExpectedGUID)
+}
+
+// verifyReceived checks that the received dataset has a snapshot with the expected GUID.
+func (z Zpool) verifyReceived(dataset, guid string) error {
+
+	// received snapshot
+	if strings.Contains(dataset, "@") {
+		snap, err := z.GetSnapshot(dataset)
+		if err != nil {
+			return errors.Wrapf(err, "unable to retrieve snapshot %q after receive", dataset)
+		}
+		if snap.GUID != guid {
+			return errors.Wrapf(ErrGUIDMismatch, "received snapshot %q has guid %q, expected %q", dataset, snap.GUID, guid)
+		}
+		return nil
+	}
+
+	// received filesystem, the sent snapshot is one of its snapshots
+	l, err := z.SnapshotsOf(Filesystem{Name: dataset})
+	if err != nil {
+		return errors.Wrapf(err, "unable to retrieve snapshots of %q after receive", dataset)
+	}
+	for _, snap := range l {
+		if snap.GUID == guid {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrGUIDMismatch, "received filesystem %q has no snapshot with guid %q", dataset, guid)
+}
+
+// VerifySnapshot checks the snapshot exists, from its properties alone so it is cheap on any snapshot size.
+// Use VerifySnapshotData to also read its data back.
+func (z Zpool) VerifySnapshot(snapshot string) error {
+	return z.VerifySnapshotGUID(snapshot, "")
+}
+
+// VerifySnapshotGUID is VerifySnapshot that also checks the snapshot has the expected GUID, such as the GUID of
+// the replicated source snapshot. An empty GUID skips the check.
+func (z Zpool) VerifySnapshotGUID(snapshot, guid string) error {
+
+	// snapshot name should start with zpool name
+	if strings.Contains(snapshot, "@") == false || !z.owns(snapshot) {
+		return errors.Errorf("bad request for snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	snap, err := z.GetSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	if len(guid) > 0 && snap.GUID != guid {
+		return errors.Wrapf(ErrGUIDMismatch, "snapshot %q has guid %q, expected %q", snapshot, snap.GUID, guid)
+	}
+
+	return nil
+}
+
+// VerifySnapshotData is VerifySnapshotGUID that also checks all of the snapshot's data can be read back.
+// The snapshot is sent to a discarding writer, so every block is read and its checksum verified by zfs,
+// which takes as long as a full send of the snapshot.
+func (z Zpool) VerifySnapshotData(snapshot, guid string) error {
+
+	if err := z.VerifySnapshotGUID(snapshot, guid); err != nil {
+		return err
+	}
+
+	// read every block of the snapshot
+	if err := z.Send(snapshot, io.Discard, SendOptions{}); err != nil {
+		return errors.Wrapf(err, "snapshot %q failed verification", snapshot)
+	}
+
+	return nil
+}
+
+// ErrNoResumableReceive is returned when a dataset has no partially received state.
+var ErrNoResumableReceive = errors.New("no resumable receive")
+
+// AbortReceive discards the partially received state of an interrupted resumable receive into the dataset.
+func (z *Zpool) AbortReceive(dataset string) error {
+
+	// dataset name should start with zpool name
+	if len(dataset) == 0 || strings.Contains(dataset, "@") || !z.owns(dataset) {
+		return errors.Errorf("bad request for dataset %q on zpool %q", dataset, z.Name)
+	}
+
+	token, err := z.resumeToken(dataset)
+	if err != nil {
+		return err
+	}
+	if len(token) == 0 {
+		return errors.Wrapf(ErrNoResumableReceive, "unable to abort receive into %q", dataset)
+	}
+
+	// zfs receive -A tank/a
+	cmd := command(zfsPath, "receive", "-A", dataset)
+	if _, err := z.run(cmd); err != nil {
+		return errors.Wrapf(err, "unable to abort receive into %q", dataset)
+	}
+
+	return nil
+}
+
+// IsReceiving checks whether a receive holds the dataset: a receive in progress into it, which zfs does in the
+// hidden %recv child, or the partially received state of an interrupted resumable receive.
+// Operations on the dataset fail with "dataset is busy" until the receive finishes or is aborted.
+func (z Zpool) IsReceiving(name string) (bool, error) {
+
+	// dataset name should start with zpool name
+	if len(name) == 0 || strings.ContainsAny(name, "@#%") || !z.owns(name) {
+		return false, errors.Errorf("bad request for dataset %q on zpool %q", name, z.Name)
+	}
+
+	token, err := z.resumeToken(name)
+	if err != nil {
+		return false, err
+	}
+	if len(token) > 0 {
+		return true, nil
+	}
+
+	return z.ExistsByName(name + "/%recv")
+}
+
+// resumeToken returns the receive_resume_token of the dataset, empty when it has no partially received state.
+func (z Zpool) resumeToken(dataset string) (string, error) {
+
+	// zfs get -Ho value receive_resume_token tank/a
+	cmd := command(zfsPath, "get", "-Ho", "value", "receive_resume_token", dataset)
+	out, err := z.run(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "dataset %q not found", dataset)
+	}
+
+	// zfs reports "-" when there is no resume token
+	if token := strings.TrimSpace(string(out)); token != "-" {
+		return token, nil
+	}
+	return "", nil
+}
+
+// limitedWriter is an io.Writer rate limited by a token bucket holding up to one second of bytes.
+type limitedWriter struct {
+	w      io.Writer
+	rate   int64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// newLimitedWriter returns a writer to w limited to rate bytes per second.
+func newLimitedWriter(w io.Writer, rate int64) *limitedWriter {
+	return &limitedWriter{w: w, rate: rate, last: time.Now()}
+}
+
+// Write writes p to the underlying writer in chunks, waiting for tokens before each chunk.
+func (l *limitedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// refill the bucket for the elapsed time
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+		l.last = now
+
+		// a chunk is at most the bucket size
+		chunk := len(p)
+		if int64(chunk) > l.rate {
+			chunk = int(l.rate)
+		}
+
+		// wait for enough tokens to write the chunk
+		if l.tokens < float64(chunk) {
+			time.Sleep(time.Duration((float64(chunk) - l.tokens) / float64(l.rate) * float64(time.Second)))
+			continue
+		}
+
+		m, err := l.w.Write(p[:chunk])
+		n += m
+		l.tokens -= float64(m)
+		p = p[m:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// progressWriter is an io.Writer calling progress with the total bytes written after each write.
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	progress func(bytesDone int64)
+}
+
+func (p *progressWriter) Write(b []byte) (n int, err error) {
+	n, err = p.w.Write(b)
+	p.done += int64(n)
+	p.progress(p.done)
+	return n, err
+}
+
+// progressReader is an io.Reader calling progress with the total bytes read after each read.
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	progress func(bytesDone int64)
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.done)
+	}
+	return n, err
+}
+
+// SendSize returns the estimated size in bytes of a full send stream of the snapshot.
+func (z Zpool) SendSize(snapshot string) (int64, error) {
+
+	// snapshot name should start with zpool name
+	if strings.Contains(snapshot, "@") == false || !z.owns(snapshot) {
+		return 0, errors.Errorf("bad request for snapshot %q on zpool %q", snapshot, z.Name)
+	}
+
+	// zfs send -nvP tank/a@snap
+	return z.sendSize(command(zfsPath, "send", "-nvP", snapshot))
+}
+
+// SendSizeIncremental returns the estimated size in bytes of an incremental send stream between the from and to snapshots.
+func (z Zpool) SendSizeIncremental(from, to string) (int64, error) {
+
+	// snapshot names should start with zpool name
+	for _, name := range []string{from, to} {
+		if strings.Contains(name, "@") == false || !z.owns(name) {
+			return 0, errors.Errorf("bad request for snapshot %q on zpool %q", name, z.Name)
+		}
+	}
+
+	// zfs send -nvP -i tank/a@snap1 tank/a@snap2
+	return z.sendSize(command(zfsPath, "send", "-nvP", "-i", from, to))
+}
+
+// UsageBetween returns the bytes written to the filesystem between the from and to snapshots, for metered billing.
+// It is the size of the incremental send stream, which counts the data actually changed. The snapshots are given
+// by their short names or their full names on the filesystem.
+func (z Zpool) UsageBetween(filesystem, fromSnap, toSnap string) (int64, error) {
+
+	// short circuit to error if the filesystem isn't on the zpool
+	if len(filesystem) == 0 || !z.owns(filesystem) || strings.ContainsAny(filesystem, "@#") {
+		return 0, errors.Errorf("bad request for usage of %q on zpool %q", filesystem, z.Name)
+	}
+
+	// both snapshots must be snapshots of the filesystem
+	from, err := snapshotOf(filesystem, fromSnap)
+	if err != nil {
+		return 0, err
+	}
+	to, err := snapshotOf(filesystem, toSnap)
+	if err != nil {
+		return 0, err
+	}
+
+	return z.SendSizeIncremental(from, to)
+}
+
+// ChainSendSize returns the total bytes of the incremental send streams between consecutive snapshots of the list,
+// such as a nightly replication chain. The snapshots must be of the same filesystem and ordered oldest first by createtxg.
+func (z Zpool) ChainSendSize(snapshots []string) (int64, error) {
+
+	if len(snapshots) == 0 {
+		return 0, errors.Errorf("bad request for send size of an empty snapshot chain on zpool %q", z.Name)
+	}
+
+	// snapshots should be on the zpool and of the same filesystem
+	filesystem := (&Snapshot{Name: snapshots[0]}).Filesystem()
+	if !z.owns(filesystem) || strings.ContainsAny(filesystem, "#") {
+		return 0, errors.Errorf("bad request for snapshot %q on zpool %q", snapshots[0], z.Name)
+	}
+	for _, name := range snapshots {
+		if full, err := snapshotOf(filesystem, name); err != nil || full != name {
+			return 0, errors.Errorf("snapshot %q is not a snapshot of %q", name, filesystem)
+		}
+	}
+
+	// the snapshots should be ordered by createtxg
+	groups, err := z.SnapshotsOfMany([]string{filesystem})
+	if err != nil {
+		return 0, err
+	}
+	txgs := make(map[string]int64)
+	for _, snap := range groups[filesystem] {
+		txgs[snap.Name] = snap.CreateTxg
+	}
+	for i, name := range snapshots {
+		txg, ok := txgs[name]
+		if !ok {
+			return 0, errors.Errorf("snapshot %q does not exist", name)
+		}
+		if i > 0 && txg <= txgs[snapshots[i-1]] {
+			return 0, errors.Errorf("snapshot %q is not newer than %q", name, snapshots[i-1])
+		}
+	}
+
+	// sum the dry run size of each incremental
+	var total int64
+	for i := 1; i < len(snapshots); i++ {
+		size, err := z.SendSizeIncremental(snapshots[i-1], snapshots[i])
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+
+	return total, nil
+}
+
+// sendSize runs the dry run `zfs send` command and parses the "size" line of its parseable output.
+func (z Zpool) sendSize(cmd *exec.Cmd) (int64, error) {
+
+	// older zfs versions print the dry run to stderr
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return 0, errors.Wrapf(err, "unable to run command %q: %s", cmdString, strings.TrimSpace(stderr.String()))
+	}
+
+	// parse the line of the form "size\t<bytes>"
+	for _, line := range strings.Split(string(out)+stderr.String(), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 2 && fields[0] == "size" {
+			return parseInt("size", fields[1])
+		}
+	}
+
+	cmdString := getCommandString(cmd)
+	return 0, errors.Errorf("send size not found in output of command %q", cmdString)
+}
@@ -0,0 +1,545 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 2 snapshots on the new filesystem
+	snaps := make([]string, 0)
+	for i := 0; i < 2; i++ {
+		snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+		if _, err = z.CreateSnapshot(snapName); err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+		snaps = append(snaps, snapName)
+	}
+
+	// full compressed send
+	{
+		var buf bytes.Buffer
+		if err := z.Send(snaps[0], &buf, SendOptions{Compressed: true}); err != nil {
+			t.Errorf("unable to send %q, received %+v", snaps[0], err)
+		} else {
+			t.Logf("sent %d bytes of %s", buf.Len(), snaps[0])
+		}
+	}
+
+	// incremental send
+	{
+		var buf bytes.Buffer
+		if err := z.SendIncremental(snaps[0], snaps[1], &buf, SendOptions{}); err != nil {
+			t.Errorf("unable to send %q to %q, received %+v", snaps[0], snaps[1], err)
+		} else {
+			t.Logf("sent %d bytes from %s to %s", buf.Len(), snaps[0], snaps[1])
+		}
+	}
+
+	// raw and compressed send, as zfs send -wc
+	{
+		var buf bytes.Buffer
+		if err := z.Send(snaps[0], &buf, SendOptions{Raw: true, Compressed: true}); err != nil {
+			t.Errorf("unable to send %q raw and compressed, received %+v", snaps[0], err)
+		}
+	}
+
+	// filesystem instead of snapshot case
+	{
+		var buf bytes.Buffer
+		if err := z.Send(fs.Name, &buf, SendOptions{}); err == nil {
+			t.Errorf("send of filesystem %q should fail", fs.Name)
+		}
+	}
+}
+
+// cancelWriter cancels the context on its first write.
+type cancelWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestSnapshotAndSend(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// snapshot and send
+	var buf bytes.Buffer
+	snap, err := z.SnapshotAndSend(fs.Name, "backup", &buf)
+	if err != nil {
+		t.Errorf("unable to snapshot and send %q, received %+v", fs.Name, err)
+	} else {
+		t.Logf("sent %d bytes of %s", buf.Len(), snap.Name)
+	}
+
+	// failed send removes the snapshot
+	before, _ := z.SnapshotsOf(fs)
+	if _, err := z.SnapshotAndSend(fs.Name, "failed", failWriter{}); err == nil {
+		t.Errorf("snapshot and send to a failing writer should fail")
+	}
+	if after, _ := z.SnapshotsOf(fs); len(after) != len(before) {
+		t.Errorf("failed snapshot and send should not leave a snapshot, found %d snapshots, expected %d", len(after), len(before))
+	}
+}
+
+func TestSendContextCancel(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// write enough data to fill the pipe several times over
+	data := make([]byte, 64*1024*1024)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(fs.Mountpoint, "data"), data, 0644); err != nil {
+		t.Errorf("unable to write data to %q, received %+v", fs.Mountpoint, err)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	if _, err = z.CreateSnapshot(snapName); err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// cancel the context mid-stream
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- z.SendContext(ctx, snapName, cancelWriter{cancel: cancel}, SendOptions{})
+	}()
+
+	// the send should return once the process is reaped
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("cancelled send of %q should fail", snapName)
+		} else {
+			t.Logf("cancelled send of %s, received %v", snapName, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("cancelled send of %q didn't return within timeout", snapName)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// send the snapshot
+	var buf bytes.Buffer
+	if err := z.Send(snap.Name, &buf, SendOptions{}); err != nil {
+		t.Errorf("unable to send %q, received %+v", snap.Name, err)
+	}
+	stream := buf.Bytes()
+
+	// receive with the expected guid
+	{
+		name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+		if err := z.Receive(name, bytes.NewReader(stream), ReceiveOptions{ExpectedGUID: snap.GUID}); err != nil {
+			t.Errorf("unable to receive %q, received %+v", name, err)
+		}
+	}
+
+	// receive with a wrong guid
+	{
+		name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+		if err := z.Receive(name, bytes.NewReader(stream), ReceiveOptions{ExpectedGUID: "bogus"}); errors.Cause(err) != ErrGUIDMismatch {
+			t.Errorf("receiving %q with bogus guid should fail with %v, received %+v", name, ErrGUIDMismatch, err)
+		}
+	}
+}
+
+func TestSendReplicate(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a child
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	child := Filesystem{Name: fmt.Sprintf("%s/child", fs.Name)}
+	if _, err := z.CreateFilesystem(child); err != nil {
+		t.Errorf("failed to create new filesystem %q", child.Name)
+	}
+
+	// snapshot the tree with the same snapshot name
+	snapName := fmt.Sprintf("new_snap_%s", uuid.New())
+	if _, err := z.CreateSnapshots([]string{fs.Name + "@" + snapName, child.Name + "@" + snapName}); err != nil {
+		t.Errorf("failed to create new snapshots %q, received %+v", snapName, err)
+	}
+
+	// send the whole tree
+	var buf bytes.Buffer
+	if err := z.Send(fs.Name+"@"+snapName, &buf, SendOptions{Replicate: true}); err != nil {
+		t.Errorf("unable to send %q with replicate, received %+v", fs.Name, err)
+	}
+
+	// receive it and check the child came along
+	name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+	if err := z.Receive(name, &buf, ReceiveOptions{}); err != nil {
+		t.Errorf("unable to receive %q, received %+v", name, err)
+	}
+	if !z.SnapshotExists(name + "/child@" + snapName) {
+		t.Errorf("replicated child snapshot %q not found", name+"/child@"+snapName)
+	}
+
+	// bad replication sources
+	for _, snapshot := range []string{fs.Name, fs.Name + "@", fs.Name + "#" + snapName, fs.Name + "@" + snapName + "@x", "@" + snapName} {
+		if err := z.Send(snapshot, io.Discard, SendOptions{Replicate: true}); err == nil {
+			t.Errorf("sending %q with replicate should fail", snapshot)
+		}
+	}
+	if err := z.SendIncremental(fs.Name+"@"+snapName, child.Name+"@"+snapName, io.Discard, SendOptions{Replicate: true}); err == nil {
+		t.Errorf("sending from %q to %q with replicate should fail", fs.Name+"@"+snapName, child.Name+"@"+snapName)
+	}
+}
+
+func TestAbortReceive(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// no resumable state case
+	if err := z.AbortReceive(fs.Name); errors.Cause(err) != ErrNoResumableReceive {
+		t.Errorf("aborting receive into %q should fail with %v, received %+v", fs.Name, ErrNoResumableReceive, err)
+	}
+
+	// bogus dataset case
+	if err := z.AbortReceive("bogus/bogus"); err == nil {
+		t.Errorf("aborting receive into bogus dataset should fail")
+	}
+}
+
+func TestIsReceiving(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// no receive case
+	if receiving, err := z.IsReceiving(fs.Name); err != nil || receiving {
+		t.Errorf("filesystem %q should not be receiving, found %t, received %+v", fs.Name, receiving, err)
+	}
+
+	// bogus dataset case
+	if _, err := z.IsReceiving("bogus/bogus"); err == nil {
+		t.Errorf("checking receive into bogus dataset should fail")
+	}
+}
+
+func TestLimitedWriter(t *testing.T) {
+
+	// 50000 bytes at 100000 bytes per second takes about half a second
+	var buf bytes.Buffer
+	w := newLimitedWriter(&buf, 100000)
+	start := time.Now()
+	n, err := w.Write(make([]byte, 50000))
+	elapsed := time.Since(start)
+
+	if err != nil || n != 50000 || buf.Len() != 50000 {
+		t.Errorf("wrote %d bytes, expected 50000, received %+v", n, err)
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("writing 50000 bytes at 100000 bytes per second took %s", elapsed)
+	} else {
+		t.Logf("wrote %d bytes in %s", n, elapsed)
+	}
+
+	// negative limit case
+	if err := z.Send(fmt.Sprintf("%s@bogus", z.Name), &buf, SendOptions{BandwidthLimit: -1}); err == nil {
+		t.Errorf("send with negative bandwidth limit should fail")
+	}
+}
+
+func TestSendReceiveProgress(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	if _, err = z.CreateSnapshot(snapName); err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// send progress should end at the stream size
+	var buf bytes.Buffer
+	var sent int64
+	if err := z.Send(snapName, &buf, SendOptions{Progress: func(n int64) { sent = n }}); err != nil {
+		t.Errorf("unable to send %q, received %+v", snapName, err)
+	} else if sent != int64(buf.Len()) {
+		t.Errorf("send progress reported %d bytes, expected %d", sent, buf.Len())
+	}
+
+	// receive progress should end at the stream size
+	size := int64(buf.Len())
+	var received int64
+	name := fmt.Sprintf("%s/new_recvfs_%s", z.Name, uuid.New())
+	if err := z.Receive(name, &buf, ReceiveOptions{Progress: func(n int64) { received = n }}); err != nil {
+		t.Errorf("unable to receive %q, received %+v", name, err)
+	} else if received != size {
+		t.Errorf("receive progress reported %d bytes, expected %d", received, size)
+	}
+}
+
+func TestSendSize(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 2 snapshots on the new filesystem
+	snaps := make([]string, 0)
+	for i := 0; i < 2; i++ {
+		snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+		if _, err = z.CreateSnapshot(snapName); err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+		snaps = append(snaps, snapName)
+	}
+
+	// full send size
+	if size, err := z.SendSize(snaps[0]); err != nil || size <= 0 {
+		t.Errorf("unable to estimate send size of %q, found %d, received %+v", snaps[0], size, err)
+	} else {
+		t.Logf("estimated send size of %s is %d bytes", snaps[0], size)
+	}
+
+	// incremental send size
+	if size, err := z.SendSizeIncremental(snaps[0], snaps[1]); err != nil {
+		t.Errorf("unable to estimate send size from %q to %q, received %+v", snaps[0], snaps[1], err)
+	} else {
+		t.Logf("estimated send size from %s to %s is %d bytes", snaps[0], snaps[1], size)
+	}
+
+	// filesystem instead of snapshot case
+	if _, err := z.SendSize(fs.Name); err == nil {
+		t.Errorf("send size of filesystem %q should fail", fs.Name)
+	}
+}
+
+func TestUsageBetween(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 2 snapshots on the new filesystem
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 2; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	// usage between the snapshots by short name
+	if size, err := z.UsageBetween(fs.Name, snaps[0].ShortName(), snaps[1].ShortName()); err != nil {
+		t.Errorf("unable to get usage of %q between %q and %q, received %+v", fs.Name, snaps[0].Name, snaps[1].Name, err)
+	} else {
+		t.Logf("usage of %s between %s and %s is %d bytes", fs.Name, snaps[0].ShortName(), snaps[1].ShortName(), size)
+	}
+
+	// snapshot of another filesystem case
+	other := fmt.Sprintf("%s/other@snap", z.Name)
+	if _, err := z.UsageBetween(fs.Name, other, snaps[1].Name); err == nil {
+		t.Errorf("usage with snapshot %q of another filesystem should fail", other)
+	}
+}
+
+func TestChainSendSize(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 3 snapshots on the new filesystem
+	chain := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		chain = append(chain, snap.Name)
+	}
+
+	// size of the chain
+	if size, err := z.ChainSendSize(chain); err != nil {
+		t.Errorf("unable to get send size of chain %v, received %+v", chain, err)
+	} else {
+		t.Logf("send size of chain %v is %d bytes", chain, size)
+	}
+
+	// out of order case
+	reversed := []string{chain[2], chain[1], chain[0]}
+	if _, err := z.ChainSendSize(reversed); err == nil {
+		t.Errorf("send size of out of order chain %v should fail", reversed)
+	}
+
+	// snapshot of another filesystem case
+	mixed := []string{chain[0], fmt.Sprintf("%s/other@snap", z.Name)}
+	if _, err := z.ChainSendSize(mixed); err == nil {
+		t.Errorf("send size of chain %v across filesystems should fail", mixed)
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+
+	// working cases
+	if err := z.VerifySnapshot(snap.Name); err != nil {
+		t.Errorf("unable to verify snapshot %q, received %+v", snap.Name, err)
+	}
+	if err := z.VerifySnapshotGUID(snap.Name, snap.GUID); err != nil {
+		t.Errorf("unable to verify snapshot %q with guid %s, received %+v", snap.Name, snap.GUID, err)
+	}
+	if err := z.VerifySnapshotData(snap.Name, snap.GUID); err != nil {
+		t.Errorf("unable to verify data of snapshot %q, received %+v", snap.Name, err)
+	}
+
+	// guid mismatch case
+	if err := z.VerifySnapshotGUID(snap.Name, "1"); errors.Cause(err) != ErrGUIDMismatch {
+		t.Errorf("verifying snapshot %q with the wrong guid should fail with %v, received %+v", snap.Name, ErrGUIDMismatch, err)
+	}
+	if err := z.VerifySnapshotData(snap.Name, "1"); errors.Cause(err) != ErrGUIDMismatch {
+		t.Errorf("verifying data of snapshot %q with the wrong guid should fail with %v, received %+v", snap.Name, ErrGUIDMismatch, err)
+	}
+
+	// missing snapshot case
+	if err := z.VerifySnapshot(fs.Name + "@bogus"); err == nil {
+		t.Errorf("verifying missing snapshot should fail")
+	}
+}
+
+func TestVerifySnapshotWithoutSend(t *testing.T) {
+
+	// only the snapshot's properties are canned, a send would fail
+	fake := Zpool{Name: "tank", Runner: fakeRunner{
+		"zfs get -t snapshot -s " + snapshotSources + " -Hpo property,value name,guid,createtxg,creation," + commentProperty + " tank@s1": "" +
+			"name\ttank@s1\nguid\t21\ncreatetxg\t20\ncreation\t1700000000\n",
+	}}
+	if err := fake.VerifySnapshotGUID("tank@s1", "21"); err != nil {
+		t.Errorf("verifying snapshot tank@s1 should not read its data, received %+v", err)
+	}
+	if err := fake.VerifySnapshotData("tank@s1", "21"); err == nil {
+		t.Errorf("verifying data of snapshot tank@s1 should send it")
+	}
+}
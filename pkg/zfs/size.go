@@ -0,0 +1,98 @@
+package zfs
+
+import (
+	"github.com/pkg/errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// sizeRE matches a size, a number with an optional fraction followed by an optional unit.
+var sizeRE = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+
+// sizePrefixes are the unit prefixes in increasing powers.
+const sizePrefixes = "KMGTPE"
+
+// ParseSize parses a size in bytes such as 10G, 1.5T or 512.
+// As in zfs, K, M, G, T, P and E are powers of 1024, alone or followed by B, i or iB, e.g. G, GB, Gi or GiB.
+// A B suffix alone, or no suffix, is bytes. Units are case insensitive. See ParseDecimalSize for powers of 1000.
+// A size that isn't a whole number of bytes, such as 1.5 or 0.1K, is an error.
+func ParseSize(s string) (int64, error) {
+	return parseWholeSize(s, false)
+}
+
+// ParseDecimalSize parses a size in bytes like ParseSize, except K, M, G, T, P and E alone or followed by B are
+// powers of 1000, e.g. 1GB is 1000000000 bytes, as disk vendors count. Followed by i or iB they are still powers
+// of 1024, e.g. GiB.
+func ParseDecimalSize(s string) (int64, error) {
+	return parseWholeSize(s, true)
+}
+
+// parseWholeSize parses the size, which must be a whole number of bytes.
+func parseWholeSize(s string, decimal bool) (int64, error) {
+
+	size, err := parseSize(s, decimal)
+	if err != nil {
+		return 0, err
+	}
+	if !size.IsInt() {
+		return 0, errors.Errorf("size %q is not a whole number of bytes", s)
+	}
+	if !size.Num().IsInt64() {
+		return 0, errors.Errorf("size %q is too large", s)
+	}
+	return size.Num().Int64(), nil
+}
+
+// parseReportedSize parses a size rounded for display by zfs, such as 12.3M in `zpool status`,
+// dropping the fraction of a byte the rounding leaves.
+func parseReportedSize(s string) (int64, error) {
+
+	size, err := parseSize(s, false)
+	if err != nil {
+		return 0, err
+	}
+	n := new(big.Int).Quo(size.Num(), size.Denom())
+	if !n.IsInt64() {
+		return 0, errors.Errorf("size %q is too large", s)
+	}
+	return n.Int64(), nil
+}
+
+// parseSize parses the size into an exact number of bytes, the prefixes alone or followed by B are powers of 1000
+// when decimal is set.
+func parseSize(s string, decimal bool) (*big.Rat, error) {
+
+	m := sizeRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, errors.Errorf("unable to parse size %q", s)
+	}
+	number, unit := m[1], strings.ToUpper(m[2])
+
+	size, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return nil, errors.Errorf("unable to parse size %q", s)
+	}
+
+	// multiply by the unit
+	if len(unit) > 0 && unit != "B" {
+		power := strings.IndexByte(sizePrefixes, unit[0]) + 1
+		if power == 0 {
+			return nil, errors.Errorf("unable to parse size %q, unknown unit %q", s, m[2])
+		}
+		base := int64(1024)
+		switch unit[1:] {
+		case "", "B":
+			if decimal {
+				base = 1000
+			}
+		case "I", "IB":
+		default:
+			return nil, errors.Errorf("unable to parse size %q, unknown unit %q", s, m[2])
+		}
+		multiplier := new(big.Int).Exp(big.NewInt(base), big.NewInt(int64(power)), nil)
+		size.Mul(size, new(big.Rat).SetInt(multiplier))
+	}
+
+	return size, nil
+}
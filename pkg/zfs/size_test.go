@@ -0,0 +1,68 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+
+	cases := map[string]int64{
+		"512":    512,
+		"0B":     0,
+		"1K":     1024,
+		"1.50K":  1536,
+		"10G":    10 * 1024 * 1024 * 1024,
+		"10g":    10 * 1024 * 1024 * 1024,
+		"10GiB":  10 * 1024 * 1024 * 1024,
+		"10Gi":   10 * 1024 * 1024 * 1024,
+		"10GB":   10 * 1024 * 1024 * 1024,
+		"2 T":    2 * 1024 * 1024 * 1024 * 1024,
+		"1PB":    1024 * 1024 * 1024 * 1024 * 1024,
+		"0.5M":   512 * 1024,
+		"7E":     7 * 1024 * 1024 * 1024 * 1024 * 1024 * 1024,
+		" 100M ": 100 * 1024 * 1024,
+	}
+	for s, expected := range cases {
+		if size, err := ParseSize(s); err != nil || size != expected {
+			t.Errorf("size %q parsed as %d, expected %d, received %+v", s, size, expected, err)
+		}
+	}
+
+	// malformed cases
+	for _, s := range []string{"", "G", "-1G", "10X", "10GX", "1.2.3K", "8E", "ten", "1.5", "0.1K", "1.1M"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("parsing size %q should fail", s)
+		}
+	}
+}
+
+func TestParseDecimalSize(t *testing.T) {
+
+	cases := map[string]int64{
+		"512":   512,
+		"1K":    1000,
+		"10GB":  10 * 1000 * 1000 * 1000,
+		"2.3KB": 2300,
+		"1.5T":  1500 * 1000 * 1000 * 1000,
+		"10GiB": 10 * 1024 * 1024 * 1024,
+		"1Ei":   1024 * 1024 * 1024 * 1024 * 1024 * 1024,
+		"9E":    9 * 1000 * 1000 * 1000 * 1000 * 1000 * 1000,
+	}
+	for s, expected := range cases {
+		if size, err := ParseDecimalSize(s); err != nil || size != expected {
+			t.Errorf("size %q parsed as %d, expected %d, received %+v", s, size, expected, err)
+		}
+	}
+
+	// malformed cases
+	for _, s := range []string{"", "10X", "10E", "0.0001K"} {
+		if _, err := ParseDecimalSize(s); err == nil {
+			t.Errorf("parsing size %q should fail", s)
+		}
+	}
+
+	// sizes reported by zfs are rounded, the fraction of a byte is dropped
+	if size, err := parseReportedSize("1.1M"); err != nil || size != 1153433 {
+		t.Errorf("reported size 1.1M parsed as %d, received %+v", size, err)
+	}
+}
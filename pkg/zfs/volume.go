@@ -0,0 +1,103 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"os/exec"
+)
+
+// CreateVolumeOfSize creates a volume on the zpool from a size such as 10G, see ParseSize.
+func (z *Zpool) CreateVolumeOfSize(name, size string) (Volume, error) {
+
+	volSize, err := ParseSize(size)
+	if err != nil {
+		return Volume{Name: name}, errors.Wrapf(err, "volume %q cannot be created with size %q", name, size)
+	}
+
+	return z.CreateVolume(Volume{Name: name, VolSize: volSize})
+}
+
+// CreateVolume creates a volume of VolSize bytes on the zpool, CreateVolumeOfSize takes a size such as 10G instead.
+// When the volume's origin is set to a volume snapshot, a clone of the snapshot is created instead and VolSize is ignored.
+func (z *Zpool) CreateVolume(vol Volume) (Volume, error) {
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(vol.Name) == 0 || vol.CreateTxg != 0 || !z.owns(vol.Name) {
+		return vol, errors.Errorf("volume %q cannot be created on zpool %q", vol.Name, z.Name)
+	}
+
+	// build command
+	var cmd *exec.Cmd
+
+	// check if origin is a snapshot
+	// if origin is not set then create new volume
+	// if origin is set then create a clone of the origin
+	origin, clone := (&Filesystem{Origin: vol.Origin}).OriginSnapshot()
+	if clone {
+		// a clone of a filesystem snapshot is a filesystem
+		typ, err := z.TypeOf(origin.Filesystem())
+		if err != nil {
+			return vol, errors.Wrapf(err, "origin %q of volume %q not found", origin.Name, vol.Name)
+		}
+		if typ != "volume" {
+			return vol, errors.Errorf("origin %q is a %s snapshot, use CreateFilesystem to clone it", origin.Name, typ)
+		}
+		cmd = command(zfsPath, "clone", origin.Name, vol.Name)
+	} else if vol.VolSize > 0 {
+		cmd = command(zfsPath, "create", "-V", fmt.Sprint(vol.VolSize), vol.Name)
+	} else {
+		return vol, errors.Errorf("volume %q cannot be created with size %d", vol.Name, vol.VolSize)
+	}
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. volume already exists
+		// 2. volume's parent path doesn't exist
+		// 3. size isn't a multiple of the volblocksize
+		// 4. zfs fails
+		return vol, errors.Wrapf(err, "unable to create volume %q", vol.Name)
+	}
+
+	// retrieve the newly created volume
+	n, err := z.GetVolume(vol.Name)
+	if err != nil {
+		return vol, errors.Wrapf(err, "unable to retrieve volume %q after creation", vol.Name)
+	}
+
+	return n, nil
+}
+
+// GetVolume will return the found Volume
+func (z Zpool) GetVolume(name string) (ds Volume, err error) {
+
+	// volume name should start with zpool name
+	if !z.owns(name) {
+		return ds, errors.Errorf("bad request for volume %q on zpool %q", name, z.Name)
+	}
+
+	// zfs get -t volume -Hpo property,value name,guid,createtxg,origin,volsize tank/vol
+	cmd := command(zfsPath, "get", "-t", "volume", "-Hpo", "property,value", "name,guid,createtxg,origin,volsize", name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		return ds, errors.Wrapf(err, "volume %q not found", name)
+	}
+
+	// parse []byte output
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		fields, err := splitFields(in.Text(), 2)
+		if err != nil {
+			return ds, err
+		}
+		if err := ds.setProperty(fields[0], fields[1]); err != nil {
+			return ds, err
+		}
+	}
+
+	return ds, nil
+}
@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func TestCreateVolume(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new volume
+	vol := Volume{Name: fmt.Sprintf("%s/new_vol_%s", z.Name, uuid.New()), VolSize: 16 * 1024 * 1024}
+	vol, err = z.CreateVolume(vol)
+	if err != nil {
+		t.Errorf("failed to create new volume %q, received %+v", vol.Name, err)
+	} else {
+		t.Logf("created new volume %s, guid: %s, volsize: %d, createtxg: %d\n", vol.Name, vol.GUID, vol.VolSize, vol.CreateTxg)
+	}
+
+	// zero size case
+	if _, err := z.CreateVolume(Volume{Name: fmt.Sprintf("%s/new_vol_%s", z.Name, uuid.New())}); err == nil {
+		t.Errorf("creating volume without size should fail")
+	}
+
+	// size string case
+	name := fmt.Sprintf("%s/new_vol_%s", z.Name, uuid.New())
+	if vol, err := z.CreateVolumeOfSize(name, "16M"); err != nil || vol.VolSize != 16*1024*1024 {
+		t.Errorf("failed to create new volume %q of size 16M, found size %d, received %+v", name, vol.VolSize, err)
+	}
+	for _, size := range []string{"", "16X", "1.5", "-16M"} {
+		name := fmt.Sprintf("%s/new_vol_%s", z.Name, uuid.New())
+		if _, err := z.CreateVolumeOfSize(name, size); err == nil {
+			t.Errorf("creating volume %q of size %q should fail", name, size)
+		}
+	}
+}
+
+func TestCreateVolumeSnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new volume
+	vol := Volume{Name: fmt.Sprintf("%s/new_vol_%s", z.Name, uuid.New()), VolSize: 16 * 1024 * 1024}
+	vol, err = z.CreateVolume(vol)
+	if err != nil {
+		t.Errorf("failed to create new volume %q, received %+v", vol.Name, err)
+	}
+
+	// create a snapshot on the new volume
+	snapName := fmt.Sprintf("%s@new_snap_%s", vol.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	} else {
+		t.Logf("created new snapshot %s, guid: %s, createtxg: %d\n", snap.Name, snap.GUID, snap.CreateTxg)
+	}
+
+	// volume snapshots are listed
+	l, err := z.ListSnapshots()
+	if err != nil {
+		t.Errorf("unable to get snapshots on %s, received %+v", z.Name, err)
+	} else if _, ok := l[snap.Name]; !ok {
+		t.Errorf("volume snapshot %q not found in listing", snap.Name)
+	}
+
+	// create a new clone volume
+	clone := Volume{Name: fmt.Sprintf("%s/new_clonevol_%s", z.Name, uuid.New()), Origin: snap.Name}
+	clone, err = z.CreateVolume(clone)
+	if err != nil {
+		t.Errorf("failed to create new clone volume %q using origin %q, received %+v", clone.Name, snap.Name, err)
+	} else {
+		t.Logf("created new clone volume %s, guid: %s, origin: %s, createtxg: %d\n", clone.Name, clone.GUID, clone.Origin, clone.CreateTxg)
+		if clone.VolSize != vol.VolSize {
+			t.Errorf("clone volume %q has size %d, expected %d", clone.Name, clone.VolSize, vol.VolSize)
+		}
+	}
+
+	// cloning a volume snapshot as a filesystem case
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: snap.Name}
+	if _, err := z.CreateFilesystem(fs); err == nil {
+		t.Errorf("cloning volume snapshot %q as a filesystem should fail", snap.Name)
+	}
+
+	// cloning a filesystem snapshot as a volume case, no clone is left behind
+	fsSnap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", z.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", z.Name)
+	}
+	badClone := Volume{Name: fmt.Sprintf("%s/new_clonevol_%s", z.Name, uuid.New()), Origin: fsSnap.Name}
+	if _, err := z.CreateVolume(badClone); err == nil {
+		t.Errorf("cloning filesystem snapshot %q as a volume should fail", fsSnap.Name)
+	}
+	if exists, _ := z.ExistsByName(badClone.Name); exists {
+		t.Errorf("clone %q of filesystem snapshot %q should not be created", badClone.Name, fsSnap.Name)
+	}
+}
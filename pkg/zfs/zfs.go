@@ -4,52 +4,379 @@ package zfs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"math"
 	"os/exec"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Zpool struct {
 	Name string
+
+	// Timeout bounds how long each zfs or zpool command may run, zero means no timeout.
+	// Streaming sends and receives are not bounded by it, use SendContext to cancel them.
+	Timeout time.Duration
+
+	// Runner runs the zfs and zpool commands whose output is parsed, nil runs them on the host.
+	// A fake Runner returning canned output lets the parsing be tested without zfs.
+	// Streaming commands such as send, receive and events always run on the host.
+	Runner Runner
+
+	// env is the extra environment of the zfs and zpool commands, set by WithEnv
+	env map[string]string
+
+	// state is shared by the copies of the zpool, set by New
+	state *zpoolState
+}
+
+// zpoolState is the lifecycle of a zpool handle, its context is cancelled by Close to stop background work.
+type zpoolState struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// jsonOnce guards the detection of native JSON output support into jsonOutput
+	jsonOnce   sync.Once
+	jsonOutput bool
 }
 
 type Filesystem struct {
-	Name      string `json:"name"`
-	GUID      string `json:"guid"`
-	Origin    string `json:"origin"`
-	CreateTxg int64  `json:"createtxg"`
+	Name       string `json:"name"`
+	GUID       string `json:"guid"`
+	Origin     string `json:"origin"`
+	CreateTxg  int64  `json:"createtxg"`
+	Mountpoint string `json:"mountpoint"`
+
+	// space used breakdown in bytes
+	UsedBySnapshots      int64 `json:"usedbysnapshots"`
+	UsedByDataset        int64 `json:"usedbydataset"`
+	UsedByChildren       int64 `json:"usedbychildren"`
+	UsedByRefReservation int64 `json:"usedbyrefreservation"`
+
+	// Quota is the quota in bytes, zero means no quota
+	Quota int64 `json:"quota"`
+
+	// compression achieved by the filesystem and its descendants, and by the referenced data alone, e.g. 1.5
+	CompressRatio    float64 `json:"compressratio"`
+	RefCompressRatio float64 `json:"refcompressratio"`
+
+	// Properties holds the extra properties requested by ListFilesystemsProps
+	Properties map[string]string `json:"properties,omitempty"`
 }
 
+// filesystemProperties are the zfs properties fetched for a Filesystem.
+var filesystemProperties = []string{"name", "origin", "guid", "createtxg", "mountpoint", "usedbysnapshots", "usedbydataset", "usedbychildren", "usedbyrefreservation", "quota", "compressratio", "refcompressratio"}
+
 type Snapshot struct {
+	Name      string    `json:"name"`
+	GUID      string    `json:"guid"`
+	CreateTxg int64     `json:"createtxg"`
+	Creation  time.Time `json:"creation"`
+	Clones    []string  `json:"clones,omitempty"`  // dependent clones, only filled by DeferredDestroyPending
+	Comment   string    `json:"comment,omitempty"` // user:comment annotation, see SetSnapshotComment
+}
+
+type Volume struct {
 	Name      string `json:"name"`
 	GUID      string `json:"guid"`
+	Origin    string `json:"origin"`
 	CreateTxg int64  `json:"createtxg"`
+	VolSize   int64  `json:"volsize"`
 }
 
 type Filesystems map[string]*Filesystem
 type Snapshots map[string]*Snapshot
+type Volumes map[string]*Volume
+
+// SortedByCreateTxg returns the snapshots ordered from oldest to newest by createtxg.
+// A createtxg zfs couldn't report is zero, when any snapshot lacks one all of them are ordered by creation time
+// instead, so a single odd snapshot doesn't break the ordering.
+func (l Snapshots) SortedByCreateTxg() []*Snapshot {
+	snapshots := make([]*Snapshot, 0, len(l))
+	for _, snap := range l {
+		snapshots = append(snapshots, snap)
+	}
+	sortByCreateTxg(snapshots)
+	return snapshots
+}
+
+// sortByCreateTxg sorts the snapshots from oldest to newest in place, see SortedByCreateTxg.
+// A single key is used for the whole slice, as mixing createtxg and creation time between pairs isn't a consistent order.
+func sortByCreateTxg(snapshots []*Snapshot) {
+
+	byTxg := true
+	for _, snap := range snapshots {
+		if snap.CreateTxg <= 0 {
+			byTxg = false
+			break
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		a, b := snapshots[i], snapshots[j]
+		if byTxg && a.CreateTxg != b.CreateTxg {
+			return a.CreateTxg < b.CreateTxg
+		}
+		if !a.Creation.Equal(b.Creation) {
+			return a.Creation.Before(b.Creation)
+		}
+		return a.Name < b.Name
+	})
+}
+
+// setProperty sets the field of the filesystem matching the zfs property.
+func (f *Filesystem) setProperty(property, value string) (err error) {
+	switch property {
+	case "name":
+		f.Name = value
+	case "guid":
+		f.GUID = value
+	case "origin":
+		f.Origin = value
+	case "createtxg":
+		f.CreateTxg, err = parseInt("createtxg", value)
+	case "mountpoint":
+		f.Mountpoint = value
+	case "usedbysnapshots":
+		f.UsedBySnapshots, err = parseInt(property, value)
+	case "usedbydataset":
+		f.UsedByDataset, err = parseInt(property, value)
+	case "usedbychildren":
+		f.UsedByChildren, err = parseInt(property, value)
+	case "usedbyrefreservation":
+		f.UsedByRefReservation, err = parseInt(property, value)
+	case "quota":
+		f.Quota, err = parseInt(property, value)
+	case "compressratio":
+		f.CompressRatio, err = parseRatio(property, value)
+	case "refcompressratio":
+		f.RefCompressRatio, err = parseRatio(property, value)
+	}
+	return err
+}
+
+// setProperty sets the field of the snapshot matching the zfs property.
+func (s *Snapshot) setProperty(property, value string) (err error) {
+	switch property {
+	case "name":
+		s.Name = value
+	case "guid":
+		s.GUID = value
+	case "createtxg":
+		s.CreateTxg, err = parseInt("createtxg", value)
+	case "creation":
+		var seconds int64
+		seconds, err = parseInt(property, value)
+		s.Creation = time.Unix(seconds, 0)
+	case "clones":
+		if len(value) > 0 && value != "-" {
+			s.Clones = strings.Split(value, ",")
+		}
+	case commentProperty:
+		if value != "-" {
+			s.Comment = unescapeComment(value)
+		}
+	}
+	return err
+}
+
+// setProperty sets the field of the volume matching the zfs property.
+func (v *Volume) setProperty(property, value string) (err error) {
+	switch property {
+	case "name":
+		v.Name = value
+	case "guid":
+		v.GUID = value
+	case "origin":
+		v.Origin = value
+	case "createtxg":
+		v.CreateTxg, err = parseInt("createtxg", value)
+	case "volsize":
+		v.VolSize, err = parseInt(property, value)
+	}
+	return err
+}
+
+// parseInt parses the numeric value of the property into int64.
+// zfs reports "-" for a property without a value, which is parsed as zero rather than failing a whole listing.
+func parseInt(property, value string) (int64, error) {
+	if value == "-" || len(value) == 0 {
+		return 0, nil
+	}
+	p, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to parse %s value %q to int64", property, value)
+	}
+	return p, nil
+}
+
+// parseRatio parses a ratio property such as compressratio, reported as 1.50x or 1.50, into float64.
+// Like parseInt, an unset value is parsed as zero.
+func parseRatio(property, value string) (float64, error) {
+	if value == "-" || len(value) == 0 {
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || !(r >= 0) || math.IsInf(r, 1) {
+		return 0, errors.Errorf("unable to parse %s value %q to a ratio", property, value)
+	}
+	return r, nil
+}
+
+// OriginSnapshot returns the snapshot the filesystem was cloned from.
+// The bool is false when the filesystem isn't a clone.
+func (f *Filesystem) OriginSnapshot() (Snapshot, bool) {
+
+	// zfs reports "-" for the origin of a filesystem that isn't a clone
+	parts := strings.Split(f.Origin, "@")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return Snapshot{}, false
+	}
+
+	return Snapshot{Name: f.Origin}, true
+}
+
+// Filesystem returns the name of the filesystem or volume the snapshot belongs to, the part before the @ sign.
+func (s *Snapshot) Filesystem() string {
+	i := strings.Index(s.Name, "@")
+	if i == -1 {
+		return s.Name
+	}
+	return s.Name[:i]
+}
+
+// ShortName returns the name of the snapshot without its filesystem, the part after the @ sign.
+// An empty string is returned for a malformed name without an @ sign.
+func (s *Snapshot) ShortName() string {
+	i := strings.Index(s.Name, "@")
+	if i == -1 {
+		return ""
+	}
+	return s.Name[i+1:]
+}
+
+// snapshotLabelReplacer replaces the characters not allowed in a snapshot label.
+var snapshotLabelReplacer = strings.NewReplacer("@", "-", "/", "-", "#", "-", " ", "-")
+
+// SnapshotName returns a snapshot name for the filesystem in the form filesystem@label-<timestamp>.
+// The timestamp is RFC3339 in UTC so the names of a label sort in creation order.
+func SnapshotName(filesystem, label string) string {
+	return fmt.Sprintf("%s@%s-%s", filesystem, snapshotLabelReplacer.Replace(label), time.Now().UTC().Format(time.RFC3339))
+}
+
+// SnapshotNameUUID returns a snapshot name for the filesystem in the form filesystem@label-<uuid>.
+func SnapshotNameUUID(filesystem, label string) string {
+	return fmt.Sprintf("%s@%s-%s", filesystem, snapshotLabelReplacer.Replace(label), uuid.New())
+}
+
+// Parent returns the name of the parent filesystem, or an empty string for the zpool root filesystem.
+func (f *Filesystem) Parent() string {
+	i := strings.LastIndex(f.Name, "/")
+	if i == -1 {
+		return ""
+	}
+	return f.Name[:i]
+}
+
+// ErrZFSUnavailable is returned when the zfs or zpool binaries are missing or can't run.
+var ErrZFSUnavailable = errors.New("zfs is not available")
+
+// ErrZpoolNotFound is returned by New when the zpool doesn't exist.
+var ErrZpoolNotFound = errors.New("zpool not found")
+
+// ErrDatasetExists is returned when creating a dataset that already exists.
+var ErrDatasetExists = errors.New("dataset already exists")
+
+// ErrRemovedAfterCreate is returned when a created dataset is destroyed by another process before it's retrieved.
+// The creation succeeded, so it can be retried.
+var ErrRemovedAfterCreate = errors.New("dataset removed after creation")
+
+// ErrCannotDestroyRoot is returned when destroying the root filesystem of the zpool, which is destroyed with the zpool.
+var ErrCannotDestroyRoot = errors.New("cannot destroy the zpool root filesystem")
 
 // New returns a new Zpool struct
 func New(zpool string) (z Zpool, err error) {
 
-	if ok := zpoolExists(zpool); !ok {
-		err := errors.New(fmt.Sprintf("zpool %q doesn't exist", zpool))
+	// zfs must be usable before probing the zpool
+	if preflightErr != nil {
+		return z, preflightErr
+	}
+
+	if err := zpoolExists(zpool); err != nil {
 		return z, err
 	}
 
-	return Zpool{Name: zpool}, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	return Zpool{Name: zpool, state: &zpoolState{ctx: ctx, cancel: cancel}}, nil
 
 }
 
-// zpoolExists checks if given zpool name exists on the system
-func zpoolExists(zpool string) bool {
-	err := exec.Command(zpoolPath, "get", "-H", "-o", "value", "name", zpool).Run()
-	if err != nil {
+// Close stops the background work of the zpool handle and its copies, such as Events watchers.
+// It is safe to call more than once, and on a zpool without background work.
+func (z *Zpool) Close() error {
+	if z.state != nil {
+		z.state.cancel()
+	}
+	return nil
+}
+
+// closed returns a channel that is closed when the zpool handle is closed, nil when it can't be closed.
+func (z Zpool) closed() <-chan struct{} {
+	if z.state == nil {
+		return nil
+	}
+	return z.state.ctx.Done()
+}
+
+// owns checks if the dataset name belongs to the zpool.
+// The name must be the zpool name or start with it followed by a /, @ or # separator, so tank2/a doesn't belong to tank.
+func (z Zpool) owns(name string) bool {
+	if name == z.Name {
+		return len(name) > 0
+	}
+	if strings.HasPrefix(name, z.Name) == false || len(name) <= len(z.Name) {
 		return false
 	}
-	return true
+	switch name[len(z.Name)] {
+	case '/', '@', '#':
+		return len(z.Name) > 0
+	}
+	return false
+}
+
+// zpoolExists checks if given zpool name exists on the system.
+// It returns ErrZpoolNotFound when the zpool is absent and ErrZFSUnavailable when the zpool command can't run.
+func zpoolExists(zpool string) error {
+	cmd := command(zpoolPath, "get", "-H", "-o", "value", "name", zpool)
+	_, err := execAndLog(cmd)
+	if err == nil {
+		return nil
+	}
+
+	// the command didn't start or exit, e.g. binary missing or not executable
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return errors.Wrapf(ErrZFSUnavailable, "unable to run command %q: %s", getCommandString(cmd), err)
+	}
+
+	// zpool get example
+	// cannot open 'bogus': no such pool
+	stderr := strings.TrimSpace(string(exitErr.Stderr))
+	if strings.Contains(stderr, "no such pool") {
+		return errors.Wrapf(ErrZpoolNotFound, "zpool %q doesn't exist", zpool)
+	}
+
+	// known ways to fail
+	// 1. zfs kernel module not loaded
+	// 2. permission denied on /dev/zfs
+	return errors.Wrapf(ErrZFSUnavailable, "command %q failed: %s", getCommandString(cmd), stderr)
 }
 
 // Snapshots will return an map of snapshots on the zpool
@@ -58,67 +385,69 @@ func (z Zpool) ListSnapshots() (l Snapshots, err error) {
 	// make map
 	l = make(Snapshots, 0)
 
-	//  zfs get -t snapshot -Hro name,property,value guid,createtxg tank
-	cmd := exec.Command(zfsPath, "get", "-t", "snapshot", "-Hro", "name,property,value", "guid,createtxg", z.Name)
-
-	// execute command
-	out, err := cmd.Output()
+	//  zfs get -t snapshot -s local,received,none -Hpro name,property,value guid,createtxg,creation,user:comment tank
+	props, names, err := z.getProperties([]string{"-t", "snapshot", "-s", snapshotSources, "-r"}, "guid,createtxg,creation,"+commentProperty, z.Name)
 	if err != nil {
-		cmdString := getCommandString(cmd)
-		return l, errors.Wrapf(err, "unable to run command %q", cmdString)
+		return l, err
 	}
 
-	// begin parsing output
-	in := bufio.NewScanner(bytes.NewReader(out))
-	for in.Scan() {
-		var name, property, value string
-		fmt.Sscanf(in.Text(), "%s\t%s\t%s", &name, &property, &value)
-
-		// check if name already exists in map
-		_, ok := l[name]
-		if !ok {
-			l[name] = &Snapshot{Name: name}
-		}
-
-		// get it now
-		ds, _ := l[name]
-
-		switch property {
-		case "guid":
-			ds.GUID = value
-		case "createtxg":
-			p, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return l, errors.Wrapf(err, "unable to convert createtxg value %q to int64", value)
+	for _, name := range names {
+		ds := &Snapshot{Name: name}
+		for property, value := range props[name] {
+			if err := ds.setProperty(property, value); err != nil {
+				return l, err
 			}
-			ds.CreateTxg = p
 		}
+		l[name] = ds
 	}
 	return l, nil
 }
 
 // CreateFilesystem creates a filesystem on the zpool.
 func (z *Zpool) CreateFilesystem(fs Filesystem) (Filesystem, error) {
+	return z.createFilesystem(fs, false)
+}
+
+// CreateFilesystemWithParents creates a filesystem on the zpool along with all of its missing parent filesystems.
+// It works for clones too, `zfs clone -p` creates the missing parents of the clone.
+func (z *Zpool) CreateFilesystemWithParents(fs Filesystem) (Filesystem, error) {
+	return z.createFilesystem(fs, true)
+}
+
+// createFilesystem creates a filesystem on the zpool, passing -p to create missing parents when parents is true.
+func (z *Zpool) createFilesystem(fs Filesystem, parents bool) (Filesystem, error) {
 
 	// short circuit to error if name doesn't start with zpool name
-	if len(fs.Name) == 0 || fs.CreateTxg != 0 || strings.HasPrefix(fs.Name, z.Name) == false {
+	if len(fs.Name) == 0 || fs.CreateTxg != 0 || !z.owns(fs.Name) {
 		return fs, errors.Errorf("filesystem %q cannot be created on zpool %q", fs.Name, z.Name)
 	}
 
 	// build command
-	var cmd *exec.Cmd
-
-	// check if origin is not empty
-	// if origin is set then create new filesystem
-	// if origin is not set then create a clone of the origin
-	if len(fs.Origin) == 0 || fs.Origin == "-" {
-		cmd = exec.Command(zfsPath, "create", fs.Name)
+	var args []string
+
+	// check if origin is a snapshot
+	// if origin is not set then create new filesystem
+	// if origin is set then create a clone of the origin
+	origin, clone := fs.OriginSnapshot()
+	if clone {
+		// a clone of a volume snapshot is a volume
+		if typ, err := z.TypeOf(origin.Filesystem()); err == nil && typ == "volume" {
+			return fs, errors.Errorf("origin %q is a volume snapshot, use CreateVolume to clone it", origin.Name)
+		}
+		args = []string{"clone"}
 	} else {
-		cmd = exec.Command(zfsPath, "clone", fs.Origin, fs.Name)
+		args = []string{"create"}
+	}
+	if parents {
+		args = append(args, "-p")
 	}
+	if clone {
+		args = append(args, origin.Name)
+	}
+	cmd := command(zfsPath, append(args, fs.Name)...)
 
 	// run command
-	if _, err := cmd.Output(); err != nil {
+	if _, err := z.run(cmd); err != nil {
 		// known ways to fail
 		// 1. filesystem already exists
 		// 2. filesystem's parent path doesn't exist
@@ -127,8 +456,12 @@ func (z *Zpool) CreateFilesystem(fs Filesystem) (Filesystem, error) {
 	}
 
 	// retrieve the newly created filesystem
+	// another process may destroy it before it's retrieved, the caller can retry the creation
 	n, err := z.GetFilesystem(fs.Name)
 	if err != nil {
+		if exists, existsErr := z.ExistsByName(fs.Name); existsErr == nil && !exists {
+			return fs, errors.Wrapf(ErrRemovedAfterCreate, "filesystem %q was removed after creation", fs.Name)
+		}
 		return fs, errors.Wrapf(err, "unable to retrieve filesystem %q after creation", fs.Name)
 	}
 
@@ -139,19 +472,22 @@ func (z *Zpool) CreateFilesystem(fs Filesystem) (Filesystem, error) {
 func (z *Zpool) CreateSnapshot(snapshotName string) (snap Snapshot, err error) {
 
 	// short circuit to error if name doesn't start with zpool name
-	if len(snapshotName) == 0 || strings.HasPrefix(snapshotName, z.Name) == false {
+	if len(snapshotName) == 0 || !z.owns(snapshotName) {
 		return snap, errors.Errorf("snapshot %q cannot be created on zpool %q", snapshotName, z.Name)
 	}
 
 	// build command
-	cmd := exec.Command(zfsPath, "snapshot", snapshotName)
+	cmd := command(zfsPath, "snapshot", snapshotName)
 
 	// run command
-	if _, err := cmd.Output(); err != nil {
+	if _, err := z.run(cmd); err != nil {
 		// known ways to fail
 		// 1. snapshot already exists
 		// 2. snapshot on non-existing filesystem
 		// 3. zfs fails
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(string(exitErr.Stderr), "dataset already exists") {
+			return snap, errors.Wrapf(ErrDatasetExists, "unable to create snapshot %q", snapshotName)
+		}
 		return snap, errors.Wrapf(err, "unable to create snapshot %q", snapshotName)
 	}
 
@@ -164,49 +500,174 @@ func (z *Zpool) CreateSnapshot(snapshotName string) (snap Snapshot, err error) {
 	return snap, nil
 }
 
+// EnsureSnapshot creates the snapshot, or returns the existing snapshot when it already exists.
+// A retried snapshot job doesn't fail because a previous attempt already created the snapshot.
+func (z *Zpool) EnsureSnapshot(snapshotName string) (Snapshot, error) {
+
+	snap, err := z.CreateSnapshot(snapshotName)
+	if errors.Cause(err) != ErrDatasetExists {
+		return snap, err
+	}
+
+	return z.GetSnapshot(snapshotName)
+}
+
+// uniqueSnapshotAttempts bounds the suffixed names CreateUniqueSnapshot tries after the given name.
+const uniqueSnapshotAttempts = 10
+
+// CreateUniqueSnapshot creates the snapshot, and when the name is already taken retries with a -1, -2, ... suffix
+// up to uniqueSnapshotAttempts times. The returned snapshot has the name that was actually created.
+func (z *Zpool) CreateUniqueSnapshot(snapshotName string) (snap Snapshot, err error) {
+
+	name := snapshotName
+	for i := 1; ; i++ {
+		snap, err = z.CreateSnapshot(name)
+		if errors.Cause(err) != ErrDatasetExists {
+			return snap, err
+		}
+		if i > uniqueSnapshotAttempts {
+			return snap, errors.Wrapf(err, "no unique name found for snapshot %q after %d attempts", snapshotName, uniqueSnapshotAttempts)
+		}
+		name = fmt.Sprintf("%s-%d", snapshotName, i)
+	}
+}
+
 // Filesystems will return an map of filesystems on the zpool
 func (z Zpool) ListFilesystems() (l Filesystems, err error) {
+	return z.listFilesystems([]string{"-r"}, z.Name)
+}
 
-	// make map
-	l = make(Filesystems, 0)
+// Children will return an array of the immediate child filesystems of the given filesystem.
+func (z Zpool) Children(name string) (children []*Filesystem, err error) {
 
-	//  zfs get -t filesystem -Hro name,property,value guid,origin,createtxg tank
-	cmd := exec.Command(zfsPath, "get", "-t", "filesystem", "-Hro", "name,property,value", "origin,guid,createtxg", z.Name)
+	children = make([]*Filesystem, 0)
 
-	// execute command
-	out, err := cmd.Output()
+	// filesystem name should start with zpool name
+	if !z.owns(name) {
+		return children, errors.Errorf("bad request for filesystem %q on zpool %q", name, z.Name)
+	}
+
+	// depth 1 includes the filesystem itself
+	l, err := z.listFilesystems([]string{"-d", "1"}, name)
+	if err != nil {
+		return children, err
+	}
+
+	for _, fs := range l {
+		if fs.Name != name {
+			children = append(children, fs)
+		}
+	}
+
+	return children, nil
+}
+
+// ListFilesystemNames returns the sorted names of the filesystems on the zpool, without fetching their properties.
+func (z Zpool) ListFilesystemNames() (names []string, err error) {
+
+	names = make([]string, 0)
+
+	// zfs list -Ho name -t filesystem -r tank
+	cmd := command(zfsPath, "list", "-Ho", "name", "-t", "filesystem", "-r", z.Name)
+
+	// run command
+	out, err := z.run(cmd)
 	if err != nil {
 		cmdString := getCommandString(cmd)
-		return l, errors.Wrapf(err, "unable to run command %q", cmdString)
+		return names, errors.Wrapf(err, "unable to run command %q", cmdString)
 	}
 
-	// begin parsing output
-	in := bufio.NewScanner(bytes.NewReader(out))
-	for in.Scan() {
-		var name, property, value string
-		fmt.Sscanf(in.Text(), "%s\t%s\t%s", &name, &property, &value)
+	for _, name := range strings.Split(string(out), "\n") {
+		if name = strings.TrimRight(name, "\r"); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
 
-		// check if name already exists in map, if not create it
-		_, ok := l[name]
-		if !ok {
-			l[name] = &Filesystem{Name: name}
+	return names, nil
+}
+
+// ListFilesystemsProps lists the filesystems on the zpool along with the given extra properties.
+// The extra property values are returned in each Filesystem's Properties map.
+func (z Zpool) ListFilesystemsProps(extraProps []string) (l Filesystems, err error) {
+
+	for _, property := range extraProps {
+		if len(property) == 0 || strings.ContainsAny(property, ", \t") {
+			return make(Filesystems, 0), errors.Errorf("bad property name %q", property)
+		}
+	}
+
+	return z.listFilesystemsProps([]string{"-r"}, extraProps, z.Name)
+}
+
+// FilesystemsWithProperty returns the filesystems of the zpool whose property has the value, sorted by name.
+// The value is compared as printed by `zfs get -p`, "-" matches a user property that isn't set.
+// A single `zfs get` of the property is run, so the filesystems only have their name and the property in Properties.
+func (z Zpool) FilesystemsWithProperty(property, value string) (filesystems []*Filesystem, err error) {
+
+	filesystems = make([]*Filesystem, 0)
+
+	if len(property) == 0 || strings.ContainsAny(property, ", \t") {
+		return filesystems, errors.Errorf("bad request for property %q on zpool %q", property, z.Name)
+	}
+
+	// zfs get -Hp -o name,value -t filesystem -r compression tank
+	cmd := command(zfsPath, "get", "-Hp", "-o", "name,value", "-t", "filesystem", "-r", property, z.Name)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return filesystems, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		fields, err := splitFields(line, 2)
+		if err != nil {
+			return filesystems, err
 		}
+		if fields[1] == value {
+			filesystems = append(filesystems, &Filesystem{Name: fields[0], Properties: map[string]string{property: fields[1]}})
+		}
+	}
+	sort.Slice(filesystems, func(i, j int) bool { return filesystems[i].Name < filesystems[j].Name })
+
+	return filesystems, nil
+}
+
+// listFilesystems will return a map of filesystems found by `zfs get` with the given flags on the target datasets.
+func (z Zpool) listFilesystems(flags []string, targets ...string) (l Filesystems, err error) {
+	return z.listFilesystemsProps(flags, nil, targets...)
+}
+
+func (z Zpool) listFilesystemsProps(flags []string, extraProps []string, targets ...string) (l Filesystems, err error) {
+
+	// make map
+	l = make(Filesystems, 0)
+
+	//  zfs get -t filesystem -Hpro name,property,value name,origin,guid,createtxg,mountpoint,usedbysnapshots,... tank
+	properties := append(append([]string{}, filesystemProperties...), extraProps...)
+	props, names, err := z.getProperties(append([]string{"-t", "filesystem"}, flags...), strings.Join(properties, ","), targets...)
+	if err != nil {
+		return l, err
+	}
 
-		// get it now
-		ds, _ := l[name]
+	for _, name := range names {
+		ds := &Filesystem{Name: name}
+		for property, value := range props[name] {
+			if err := ds.setProperty(property, value); err != nil {
+				return l, err
+			}
+		}
 
-		switch property {
-		case "origin":
-			ds.Origin = value
-		case "guid":
-			ds.GUID = value
-		case "createtxg":
-			p, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return l, errors.Wrapf(err, "unable to convert createtxg value %q to int64", value)
+		// keep the requested extra properties
+		if len(extraProps) > 0 {
+			ds.Properties = make(map[string]string, len(extraProps))
+			for _, property := range extraProps {
+				ds.Properties[property] = props[name][property]
 			}
-			ds.CreateTxg = p
 		}
+		l[name] = ds
 	}
 	return l, nil
 }
@@ -222,7 +683,7 @@ func (z Zpool) ClonesOf(s Snapshot) (clones []*Filesystem, err error) {
 	}
 
 	for _, fs := range l {
-		if fs.Origin == s.Name {
+		if origin, ok := fs.OriginSnapshot(); ok && origin.Name == s.Name {
 			clones = append(clones, fs)
 		}
 	}
@@ -230,84 +691,147 @@ func (z Zpool) ClonesOf(s Snapshot) (clones []*Filesystem, err error) {
 	return clones, nil
 }
 
+// DatasetKind classifies a dataset by its clone relationships, a dataset can be both a clone and an origin.
+type DatasetKind int
+
+const (
+	KindIndependent DatasetKind = 0
+	KindClone       DatasetKind = 1 << (iota - 1) // has an origin snapshot
+	KindOrigin                                    // has a snapshot with dependent clones
+)
+
+// String returns the kind as independent, clone, origin or clone,origin.
+func (k DatasetKind) String() string {
+	switch k {
+	case KindIndependent:
+		return "independent"
+	case KindClone:
+		return "clone"
+	case KindOrigin:
+		return "origin"
+	case KindClone | KindOrigin:
+		return "clone,origin"
+	}
+	return fmt.Sprintf("DatasetKind(%d)", int(k))
+}
+
+// Classify returns whether the dataset is a clone, an origin of clones, both or independent.
+// A snapshot is an origin when it has dependent clones.
+func (z Zpool) Classify(name string) (kind DatasetKind, err error) {
+
+	// dataset name should start with zpool name
+	if len(name) == 0 || !z.owns(name) {
+		return kind, errors.Errorf("bad request for dataset %q on zpool %q", name, z.Name)
+	}
+
+	// depth 1 includes the snapshots of the dataset
+	// zfs get -t filesystem,volume,snapshot -d 1 -Hpo name,property,value origin,clones tank/a
+	props, _, err := z.getProperties([]string{"-t", "filesystem,volume,snapshot", "-d", "1"}, "origin,clones", name)
+	if err != nil {
+		return kind, errors.Wrapf(err, "dataset %q not found", name)
+	}
+
+	if origin := props[name]["origin"]; len(origin) > 0 && origin != "-" {
+		kind |= KindClone
+	}
+
+	for ds, p := range props {
+		if ds != name && !strings.HasPrefix(ds, name+"@") {
+			continue
+		}
+		if clones := p["clones"]; len(clones) > 0 && clones != "-" {
+			kind |= KindOrigin
+		}
+	}
+
+	return kind, nil
+}
+
 // Filesystem...
 func (z Zpool) GetFilesystem(name string) (ds Filesystem, err error) {
+	ds, _, err = z.GetFilesystemProps(name)
+	return ds, err
+}
+
+// GetFilesystemProps will return the found Filesystem along with the values of the extra properties, in a single zfs command.
+func (z Zpool) GetFilesystemProps(name string, extraProps ...string) (ds Filesystem, props map[string]string, err error) {
+
+	props = make(map[string]string)
 
 	// filesystem name should start with zpool name
-	if strings.HasPrefix(name, z.Name) == false {
-		return ds, errors.Errorf("bad request for filesystem %q on zpool %q", name, z.Name)
+	if !z.owns(name) {
+		return ds, props, errors.Errorf("bad request for filesystem %q on zpool %q", name, z.Name)
+	}
+	for _, property := range extraProps {
+		if len(property) == 0 || strings.ContainsAny(property, ", \t") {
+			return ds, props, errors.Errorf("bad property name %q", property)
+		}
 	}
+
 	// example command
-	// zfs get -t filesystem -Ho property,value name,guid,createtxg,origin tank/now
+	// zfs get -t filesystem -Hpo property,value name,origin,guid,createtxg,mountpoint,usedbysnapshots,...,used tank/now
 
 	// build command
-	cmd := exec.Command(zfsPath, "get", "-t", "filesystem", "-Ho", "property,value", "name,guid,createtxg,origin", name)
+	properties := append(append([]string{}, filesystemProperties...), extraProps...)
+	cmd := command(zfsPath, "get", "-t", "filesystem", "-Hpo", "property,value", strings.Join(properties, ","), name)
 
 	// run command
-	out, err := cmd.Output()
+	out, err := z.run(cmd)
 	if err != nil {
-		return ds, errors.Wrapf(err, "filesystem %q not found", name)
+		return ds, props, errors.Wrapf(err, "filesystem %q not found", name)
+	}
+
+	// collect the requested extra properties
+	extra := make(map[string]bool)
+	for _, property := range extraProps {
+		extra[property] = true
 	}
 
 	// parse []byte output
 	in := bufio.NewScanner(bytes.NewReader(out))
 	for in.Scan() {
-		var property, value string
-		fmt.Sscanf(in.Text(), "%s\t%s", &property, &value)
-		switch property {
-		case "name":
-			ds.Name = value
-		case "guid":
-			ds.GUID = value
-		case "createtxg":
-			// parse the createtxg value into int64
-			p, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return ds, errors.Wrapf(err, "unable to parse createtxg value %q to int64", value)
-			}
-			ds.CreateTxg = p
-		case "origin":
-			ds.Origin = value
+		fields, err := splitFields(in.Text(), 2)
+		if err != nil {
+			return ds, props, err
+		}
+		property, value := fields[0], fields[1]
+		if err := ds.setProperty(property, value); err != nil {
+			return ds, props, err
+		}
+		if extra[property] {
+			props[property] = value
 		}
 	}
 
-	return ds, nil
+	return ds, props, nil
 }
 
 // Snapshot will return the found Snapshot
 func (z Zpool) GetSnapshot(name string) (ds Snapshot, err error) {
 
 	// snapshot name should start with zpool name
-	if strings.HasPrefix(name, z.Name) == false {
+	if !z.owns(name) {
 		return ds, errors.Errorf("bad request for snapshot %q on zpool %q", name, z.Name)
 	}
 
 	// build command
-	cmd := exec.Command(zfsPath, "get", "-t", "snapshot", "-Ho", "property,value", "name,guid,createtxg", name)
+	cmd := command(zfsPath, "get", "-t", "snapshot", "-s", snapshotSources, "-Hpo", "property,value", "name,guid,createtxg,creation,"+commentProperty, name)
 
 	// run command
-	out, err := cmd.Output()
+	out, err := z.run(cmd)
 	if err != nil {
 		return ds, errors.Errorf("snapshot %q not found", name)
 	}
 
-	// parse []byte output
+	// parse []byte output, the value of a comment may contain spaces
 	in := bufio.NewScanner(bytes.NewReader(out))
 	for in.Scan() {
-		var property, value string
-		fmt.Sscanf(in.Text(), "%s\t%s", &property, &value)
-		switch property {
-		case "name":
-			ds.Name = value
-		case "guid":
-			ds.GUID = value
-		case "createtxg":
-			// parse the createtxg value into int64
-			p, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				return ds, errors.Wrapf(err, "unable to parse createtxg value %q to int64", value)
-			}
-			ds.CreateTxg = p
+		fields, err := splitFields(in.Text(), 2)
+		if err != nil {
+			return ds, err
+		}
+		if err := ds.setProperty(fields[0], fields[1]); err != nil {
+			return ds, err
 		}
 	}
 
@@ -326,9 +850,7 @@ func (z Zpool) SnapshotsOf(fs Filesystem) (snapshots []*Snapshot, err error) {
 	}
 
 	for _, ds := range l {
-		// the filesystem name is before the @ sign
-		fsName := strings.Split(ds.Name, "@")[0]
-		if fsName == fs.Name {
+		if ds.Filesystem() == fs.Name {
 			snapshots = append(snapshots, ds)
 		}
 	}
@@ -336,43 +858,1045 @@ func (z Zpool) SnapshotsOf(fs Filesystem) (snapshots []*Snapshot, err error) {
 	return snapshots, nil
 }
 
-// ExistsByGUID will return true or false if a matching GUID is found on a dataset in the zpool. This executes a zfs command to get all datasets' GUID on the zpool.
-func (z Zpool) ExistsByGUID(guid string) bool {
-	// short circuit
-	if len(guid) == 0 {
-		return false
+// SnapshotsOfMany lists the snapshots of the filesystems in a single `zfs get` scoped to them, grouped by filesystem.
+// Each group is sorted by createtxg, oldest first, and every given filesystem has a group even without snapshots.
+func (z Zpool) SnapshotsOfMany(filesystems []string) (groups map[string][]*Snapshot, err error) {
+
+	groups = make(map[string][]*Snapshot)
+	if len(filesystems) == 0 {
+		return groups, nil
+	}
+
+	for _, name := range filesystems {
+		if !z.owns(name) || strings.ContainsAny(name, "@#") {
+			return groups, errors.Errorf("bad request for filesystem %q on zpool %q", name, z.Name)
+		}
+		groups[name] = make([]*Snapshot, 0)
 	}
 
-	// zfs get -r -Ho value guid tank
-	cmd := exec.Command(zfsPath, "get", "-r", "-Ho", "value", "guid", z.Name)
-	out, err := cmd.Output()
+	// depth 1 lists the snapshots of each target
+	//  zfs get -t snapshot -s local,received,none -d 1 -Hpo name,property,value guid,createtxg,creation,user:comment tank/a tank/b
+	props, names, err := z.getProperties([]string{"-t", "snapshot", "-s", snapshotSources, "-d", "1"}, "guid,createtxg,creation,"+commentProperty, filesystems...)
 	if err != nil {
-		return false
+		return groups, err
 	}
 
-	// scan through lines
-	in := bufio.NewScanner(bytes.NewReader(out))
-	for in.Scan() {
-		if in.Text() == guid {
-			return true
+	for _, name := range names {
+		ds := &Snapshot{Name: name}
+		for property, value := range props[name] {
+			if err := ds.setProperty(property, value); err != nil {
+				return groups, err
+			}
 		}
+		groups[ds.Filesystem()] = append(groups[ds.Filesystem()], ds)
 	}
 
-	// no match found
-	return false
+	for _, snapshots := range groups {
+		sortByCreateTxg(snapshots)
+	}
+
+	return groups, nil
 }
 
-// ExistsByName will return true or false if the dataset name is found on the zpool.
-func (z Zpool) ExistsByName(name string) bool {
+// IsAncestorSnapshot checks the snapshot is in the history of the filesystem's current state: a snapshot of the
+// filesystem, or when the filesystem is a clone, its origin snapshot or an older snapshot of the origin's filesystem,
+// following origins up to an independent filesystem.
+func (z Zpool) IsAncestorSnapshot(snapshot, filesystem string) (bool, error) {
 
-	// short circuit to false if name doesn't start with zpool name
-	if len(name) == 0 || strings.HasPrefix(name, z.Name) == false {
-		return false
+	snap, err := z.GetSnapshot(snapshot)
+	if err != nil {
+		return false, err
 	}
 
-	err := exec.Command(zfsPath, "get", "-Ho", "value", "name", name).Run()
+	// walk up the clone origins, snapshots of each filesystem count up to the txg its descendant was cloned at
+	current, limit := filesystem, int64(math.MaxInt64)
+	for visited := map[string]bool{}; !visited[current]; {
+		visited[current] = true
+		if snap.Filesystem() == current {
+			return snap.CreateTxg <= limit, nil
+		}
+
+		fs, err := z.GetFilesystem(current)
+		if err != nil {
+			return false, err
+		}
+		origin, ok := fs.OriginSnapshot()
+		if !ok {
+			return false, nil
+		}
+		origin, err = z.GetSnapshot(origin.Name)
+		if err != nil {
+			return false, err
+		}
+		current, limit = origin.Filesystem(), origin.CreateTxg
+	}
+
+	return false, errors.Errorf("filesystem %q has an origin loop", filesystem)
+}
+
+// SnapshotsByFilesystem lists the snapshots of the zpool once and groups them by their filesystem or volume.
+// Each group is sorted by createtxg, oldest first.
+func (z Zpool) SnapshotsByFilesystem() (groups map[string][]*Snapshot, err error) {
+
+	groups = make(map[string][]*Snapshot)
+
+	l, err := z.ListSnapshots()
 	if err != nil {
-		return false
+		return groups, err
 	}
-	return true
+
+	for _, ds := range l {
+		groups[ds.Filesystem()] = append(groups[ds.Filesystem()], ds)
+	}
+
+	for _, snapshots := range groups {
+		sortByCreateTxg(snapshots)
+	}
+
+	return groups, nil
+}
+
+// ExistsByGUID will return true or false if a matching GUID is found on a dataset in the zpool. This executes a zfs command to get all datasets' GUID on the zpool.
+// The optional types, e.g. "snapshot", limit the scan to datasets of those types.
+func (z Zpool) ExistsByGUID(guid string, types ...string) bool {
+	// short circuit
+	if len(guid) == 0 {
+		return false
+	}
+
+	// zfs get -r -t snapshot -Ho value guid tank
+	args := []string{"get", "-r"}
+	if len(types) > 0 {
+		args = append(args, "-t", strings.Join(types, ","))
+	}
+	args = append(args, "-Ho", "value", "guid", z.Name)
+	cmd := command(zfsPath, args...)
+	out, err := z.run(cmd)
+	if err != nil {
+		return false
+	}
+
+	// scan through lines
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		if in.Text() == guid {
+			return true
+		}
+	}
+
+	// no match found
+	return false
+}
+
+// ExistsByName will return true if the dataset name is found on the zpool, and false if the dataset doesn't exist.
+// An error is returned when the zfs command fails for any other reason, such as a missing binary or a permission problem.
+func (z Zpool) ExistsByName(name string) (bool, error) {
+
+	// short circuit to false if name doesn't start with zpool name
+	if len(name) == 0 || !z.owns(name) {
+		return false, nil
+	}
+
+	// zfs list -H -o name tank/a
+	cmd := command(zfsPath, "list", "-H", "-o", "name", name)
+	if _, err := z.run(cmd); err != nil {
+		// zfs exits non-zero with a known message when the dataset is absent
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(string(exitErr.Stderr), "dataset does not exist") {
+			return false, nil
+		}
+		cmdString := getCommandString(cmd)
+		return false, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+	return true, nil
+}
+
+// DestroyPreview returns the names of the datasets and snapshots that would be destroyed by `zfs destroy` on the given name.
+// The destroy is run with -n so nothing is actually destroyed.
+func (z Zpool) DestroyPreview(name string, recursive bool) (l []string, err error) {
+
+	l = make([]string, 0)
+
+	// short circuit to error if name doesn't start with zpool name
+	if len(name) == 0 || !z.owns(name) {
+		return l, errors.Errorf("dataset %q cannot be destroyed on zpool %q", name, z.Name)
+	}
+
+	// zfs destroy -nvr tank/a
+	args := []string{"destroy", "-nv"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, name)
+	cmd := command(zfsPath, args...)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return l, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// parse lines of the form "would destroy tank/a@snap"
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		if ds := strings.TrimPrefix(in.Text(), "would destroy "); ds != in.Text() {
+			l = append(l, ds)
+		}
+	}
+
+	return l, nil
+}
+
+// CloneAndMount creates a clone of the snapshot mounted at the given mountpoint.
+// The clone is destroyed if it cannot be mounted, so a failed call leaves nothing behind.
+func (z *Zpool) CloneAndMount(snapshot, newFs, mountpoint string) (fs Filesystem, err error) {
+
+	// short circuit to error if names don't start with zpool name
+	if len(newFs) == 0 || !z.owns(newFs) || !z.owns(snapshot) {
+		return fs, errors.Errorf("clone %q of %q cannot be created on zpool %q", newFs, snapshot, z.Name)
+	}
+
+	// mountpoint must be an absolute path
+	if strings.HasPrefix(mountpoint, "/") == false {
+		return fs, errors.Errorf("mountpoint %q must be an absolute path", mountpoint)
+	}
+
+	// the clone is created unmounted, a failed mount would otherwise fail `zfs clone` after creating the clone
+	// zfs clone -o mountpoint=/srv/x -o canmount=noauto tank/a@snap tank/x
+	cmd := command(zfsPath, "clone", "-o", "mountpoint="+mountpoint, "-o", "canmount=noauto", snapshot, newFs)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		return fs, errors.Wrapf(err, "unable to clone %q to %q", snapshot, newFs)
+	}
+
+	// mount the clone, then let it mount automatically like any filesystem
+	// zfs mount tank/x
+	// zfs set canmount=on tank/x
+	err = z.mount(newFs)
+	if err == nil {
+		err = z.SetProperty(newFs, "canmount", "on")
+	}
+	if err != nil {
+		if derr := z.destroy(newFs); derr != nil {
+			return fs, errors.Wrapf(err, "unable to mount clone %q and unable to destroy it: %v", newFs, derr)
+		}
+		return fs, errors.Wrapf(err, "unable to mount clone %q", newFs)
+	}
+
+	// retrieve the newly created filesystem
+	fs, err = z.GetFilesystem(newFs)
+	if err != nil {
+		return fs, errors.Wrapf(err, "unable to retrieve filesystem %q after creation", newFs)
+	}
+
+	return fs, nil
+}
+
+// CloneWithQuota creates a clone of the snapshot with the quota in bytes set at creation.
+// The quota is set by the clone itself, so the clone never exists without it.
+func (z *Zpool) CloneWithQuota(snapshot, newFs string, quota int64) (fs Filesystem, err error) {
+
+	// short circuit to error if names don't start with zpool name
+	i := strings.Index(snapshot, "@")
+	if len(newFs) == 0 || !z.owns(newFs) || !z.owns(snapshot) || i <= 0 || i == len(snapshot)-1 {
+		return fs, errors.Errorf("clone %q of %q cannot be created on zpool %q", newFs, snapshot, z.Name)
+	}
+
+	if quota <= 0 {
+		return fs, errors.Errorf("quota %d of clone %q must be positive", quota, newFs)
+	}
+
+	// zfs clone -o quota=1073741824 tank/a@snap tank/x
+	cmd := command(zfsPath, "clone", "-o", fmt.Sprintf("quota=%d", quota), snapshot, newFs)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. snapshot doesn't exist
+		// 2. clone already exists
+		// 3. zfs fails
+		return fs, errors.Wrapf(err, "unable to clone %q to %q", snapshot, newFs)
+	}
+
+	// retrieve the newly created filesystem
+	fs, err = z.GetFilesystem(newFs)
+	if err != nil {
+		return fs, errors.Wrapf(err, "unable to retrieve filesystem %q after creation", newFs)
+	}
+
+	return fs, nil
+}
+
+// CreateEphemeralClone clones the snapshot to a read-only filesystem for serving, along with a cleanup function
+// that unmounts and destroys the clone. The cleanup should be deferred by the caller, it can be called more than once.
+func (z *Zpool) CreateEphemeralClone(snapshot, name string) (fs Filesystem, cleanup func() error, err error) {
+
+	// short circuit to error if names don't start with zpool name
+	i := strings.Index(snapshot, "@")
+	if len(name) == 0 || name == z.Name || !z.owns(name) || strings.ContainsAny(name, "@#") || !z.owns(snapshot) || i <= 0 || i == len(snapshot)-1 {
+		return fs, nil, errors.Errorf("clone %q of %q cannot be created on zpool %q", name, snapshot, z.Name)
+	}
+
+	// zfs clone -o readonly=on tank/a@snap tank/x
+	cmd := command(zfsPath, "clone", "-o", "readonly=on", snapshot, name)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. snapshot doesn't exist
+		// 2. clone already exists
+		// 3. zfs fails
+		return fs, nil, errors.Wrapf(err, "unable to clone %q to %q", snapshot, name)
+	}
+
+	destroyed := false
+	cleanup = func() error {
+		if destroyed {
+			return nil
+		}
+		if err := z.unmount(name); err != nil {
+			return err
+		}
+		if err := z.DestroyFilesystem(name); err != nil {
+			return err
+		}
+		destroyed = true
+		return nil
+	}
+
+	// retrieve the newly created filesystem, the clone is removed if it can't be
+	fs, err = z.GetFilesystem(name)
+	if err != nil {
+		if cerr := cleanup(); cerr != nil {
+			return fs, nil, errors.Wrapf(err, "unable to retrieve filesystem %q after creation, nor remove it: %v", name, cerr)
+		}
+		return fs, nil, errors.Wrapf(err, "unable to retrieve filesystem %q after creation", name)
+	}
+
+	return fs, cleanup, nil
+}
+
+// mounted checks the filesystem is mounted.
+func (z Zpool) mounted(name string) (bool, error) {
+
+	// zfs get -Ho value mounted tank/x
+	cmd := command(zfsPath, "get", "-Ho", "value", "mounted", name)
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return false, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return strings.TrimSpace(string(out)) == "yes", nil
+}
+
+// mount mounts the filesystem if it isn't already mounted.
+func (z Zpool) mount(name string) error {
+
+	// already mounted
+	if mounted, err := z.mounted(name); err != nil || mounted {
+		return err
+	}
+
+	cmd := command(zfsPath, "mount", name)
+	if _, err := z.run(cmd); err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
+
+// unmount unmounts the filesystem if it is mounted.
+func (z Zpool) unmount(name string) error {
+
+	// already unmounted
+	if mounted, err := z.mounted(name); err != nil || !mounted {
+		return err
+	}
+
+	cmd := command(zfsPath, "unmount", name)
+	if _, err := z.run(cmd); err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
+
+// DestroyFilesystem destroys the filesystem, which must have no children or snapshots.
+func (z *Zpool) DestroyFilesystem(name string) error {
+
+	// the root filesystem can only go away with the zpool
+	if name == z.Name {
+		return errors.Wrapf(ErrCannotDestroyRoot, "filesystem %q cannot be destroyed", name)
+	}
+
+	// short circuit to error if name isn't a filesystem of the zpool
+	if !z.owns(name) || strings.ContainsAny(name, "@#") {
+		return errors.Errorf("filesystem %q cannot be destroyed on zpool %q", name, z.Name)
+	}
+
+	// known ways to fail
+	// 1. filesystem doesn't exist
+	// 2. filesystem has children or snapshots
+	// 3. filesystem is busy
+	return z.destroy(name)
+}
+
+// DestructionOrder returns the root dataset and everything under it, snapshots included, in an order safe to destroy
+// one at a time: snapshots and children before their filesystem, clones before their origin snapshot.
+// The root is left out when it is the zpool's root filesystem, which can't be destroyed. A clone outside the root
+// depending on a snapshot under it is an error, as the tree can't be destroyed without it.
+func (z Zpool) DestructionOrder(root string) (order []string, err error) {
+
+	order = make([]string, 0)
+
+	// short circuit to error if the root isn't a filesystem or volume of the zpool
+	if len(root) == 0 || !z.owns(root) || strings.ContainsAny(root, "@#") {
+		return order, errors.Errorf("bad request for destruction order of %q on zpool %q", root, z.Name)
+	}
+
+	// clones may be anywhere on the zpool
+	//  zfs get -t filesystem,volume,snapshot -Hpro name,property,value origin tank
+	props, names, err := z.getProperties([]string{"-t", "filesystem,volume,snapshot", "-r"}, "origin", z.Name)
+	if err != nil {
+		return order, err
+	}
+	if _, ok := props[root]; !ok {
+		return order, errors.Errorf("dataset %q not found", root)
+	}
+	inTree := func(name string) bool {
+		return name == root || strings.HasPrefix(name, root+"/") || strings.HasPrefix(name, root+"@")
+	}
+
+	// before maps a dataset to the datasets that must be destroyed before it
+	before := make(map[string][]string)
+	for _, name := range names {
+		if origin := props[name]["origin"]; len(origin) > 0 && origin != "-" && inTree(origin) {
+			if !inTree(name) {
+				return order, errors.Errorf("clone %q outside of %q depends on snapshot %q", name, root, origin)
+			}
+			before[origin] = append(before[origin], name)
+		}
+		if i := strings.Index(name, "@"); i > 0 {
+			before[name[:i]] = append(before[name[:i]], name)
+		} else if name != z.Name {
+			before[path.Dir(name)] = append(before[path.Dir(name)], name)
+		}
+	}
+
+	// depth first, a dataset is appended once everything before it is
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, dependent := range before[name] {
+			visit(dependent)
+		}
+		if name != z.Name {
+			order = append(order, name)
+		}
+	}
+	visit(root)
+
+	return order, nil
+}
+
+// DestroySnapshot destroys the snapshot, the name is in the form filesystem@snapshot.
+func (z *Zpool) DestroySnapshot(name string) error {
+
+	// short circuit to error if name isn't a snapshot of the zpool
+	// a bookmark name or a snapshot range must not be accepted
+	i := strings.Index(name, "@")
+	if !z.owns(name) || i <= 0 || i == len(name)-1 || strings.ContainsAny(name, "#%,") || strings.Count(name, "@") != 1 {
+		return errors.Errorf("snapshot %q cannot be destroyed on zpool %q", name, z.Name)
+	}
+
+	// known ways to fail
+	// 1. snapshot doesn't exist
+	// 2. snapshot has dependent clones
+	// 3. snapshot has holds
+	return z.destroy(name)
+}
+
+// snapshotOf returns the full name of the snapshot of the filesystem, given its short name or full name.
+func snapshotOf(filesystem, name string) (string, error) {
+	short := strings.TrimPrefix(name, filesystem+"@")
+	if len(short) == 0 || strings.ContainsAny(short, "@/#%,") {
+		return "", errors.Errorf("snapshot %q is not a snapshot of %q", name, filesystem)
+	}
+	return filesystem + "@" + short, nil
+}
+
+// DestroySnapshotRange destroys the snapshots of the filesystem from fromSnap to toSnap inclusive in a single call.
+// The snapshots are given by their short names, or their full names on the filesystem.
+func (z *Zpool) DestroySnapshotRange(filesystem, fromSnap, toSnap string) error {
+
+	// short circuit to error if the filesystem isn't on the zpool
+	if len(filesystem) == 0 || !z.owns(filesystem) || strings.ContainsAny(filesystem, "@#") {
+		return errors.Errorf("snapshots of %q cannot be destroyed on zpool %q", filesystem, z.Name)
+	}
+
+	// both endpoints must be snapshots of the filesystem
+	endpoints := make([]Snapshot, 0, 2)
+	for _, name := range []string{fromSnap, toSnap} {
+		name, err := snapshotOf(filesystem, name)
+		if err != nil {
+			return err
+		}
+		snap, err := z.GetSnapshot(name)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, snap)
+	}
+
+	from, to := endpoints[0], endpoints[1]
+	if from.CreateTxg > to.CreateTxg {
+		return errors.Errorf("snapshot %q is newer than %q", from.Name, to.Name)
+	}
+
+	// known ways to fail
+	// 1. a snapshot in the range has dependent clones
+	// 2. a snapshot in the range has holds
+	// zfs destroy tank/a@snap1%snap5
+	return z.destroy(fmt.Sprintf("%s@%s%%%s", filesystem, from.ShortName(), to.ShortName()))
+}
+
+// destroy destroys the dataset without validating its name, callers validate it first.
+func (z Zpool) destroy(name string) error {
+
+	cmd := command(zfsPath, "destroy", name)
+	if _, err := z.run(cmd); err != nil {
+		cmdString := getCommandString(cmd)
+		return errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	return nil
+}
+
+// ReclaimableSpace returns the number of bytes that would be freed by destroying the given snapshots together.
+// All snapshots must belong to the same filesystem, they are passed to `zfs destroy -n` as a single comma separated spec.
+func (z Zpool) ReclaimableSpace(snapshots []string) (int64, error) {
+
+	if len(snapshots) == 0 {
+		return 0, errors.New("no snapshots given")
+	}
+
+	// build the tank/a@snap1,snap2,snap3 spec
+	var fsName string
+	snapNames := make([]string, 0, len(snapshots))
+	for _, name := range snapshots {
+		parts := strings.Split(name, "@")
+		if len(parts) != 2 || len(parts[1]) == 0 || !z.owns(name) {
+			return 0, errors.Errorf("bad request for snapshot %q on zpool %q", name, z.Name)
+		}
+		if len(fsName) == 0 {
+			fsName = parts[0]
+		} else if parts[0] != fsName {
+			return 0, errors.Errorf("snapshot %q doesn't belong to filesystem %q", name, fsName)
+		}
+		snapNames = append(snapNames, parts[1])
+	}
+	spec := fmt.Sprintf("%s@%s", fsName, strings.Join(snapNames, ","))
+
+	// zfs destroy -nvp tank/a@snap1,snap2
+	cmd := command(zfsPath, "destroy", "-nvp", spec)
+
+	// run command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return 0, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// parse the line of the form "reclaim\t<bytes>"
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		fields, err := splitFields(in.Text(), 2)
+		if err != nil {
+			return 0, err
+		}
+		if fields[0] == "reclaim" {
+			return parseInt("reclaim", fields[1])
+		}
+	}
+
+	return 0, errors.Errorf("reclaimable space not found for %q", spec)
+}
+
+// PromotionSpaceImpact estimates the bytes charged to the clone if it's promoted. Promotion moves the snapshots of
+// the origin's filesystem, up to and including the origin snapshot, to the clone. The estimate is the sum of the
+// used space of those snapshots, which doesn't count space shared between them, so it is a lower bound.
+func (z Zpool) PromotionSpaceImpact(clone string) (int64, error) {
+
+	fs, err := z.GetFilesystem(clone)
+	if err != nil {
+		return 0, err
+	}
+	origin, ok := fs.OriginSnapshot()
+	if !ok {
+		return 0, errors.Errorf("filesystem %q is not a clone", clone)
+	}
+	origin, err = z.GetSnapshot(origin.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	// zfs get -t snapshot -d 1 -Hpo name,property,value createtxg,used tank/a
+	props, names, err := z.getProperties([]string{"-t", "snapshot", "-d", "1"}, "createtxg,used", origin.Filesystem())
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, name := range names {
+		txg, err := parseInt("createtxg", props[name]["createtxg"])
+		if err != nil {
+			return 0, err
+		}
+		if txg > origin.CreateTxg {
+			continue
+		}
+		used, err := parseInt("used", props[name]["used"])
+		if err != nil {
+			return 0, err
+		}
+		total += used
+	}
+
+	return total, nil
+}
+
+// PinnedSpace returns the origin snapshots of the zpool mapped to the bytes they hold that can't be freed while
+// clones depend on them. It is the used space of each snapshot with clones, the space destroying it alone would
+// free, which the clones must be promoted or destroyed to release.
+func (z Zpool) PinnedSpace() (pinned map[string]int64, err error) {
+
+	pinned = make(map[string]int64)
+
+	//  zfs get -t snapshot -Hpro name,property,value clones,used tank
+	props, names, err := z.getProperties([]string{"-t", "snapshot", "-r"}, "clones,used", z.Name)
+	if err != nil {
+		return pinned, err
+	}
+
+	for _, name := range names {
+		if clones := props[name]["clones"]; len(clones) == 0 || clones == "-" {
+			continue
+		}
+		used, err := parseInt("used", props[name]["used"])
+		if err != nil {
+			return pinned, err
+		}
+		pinned[name] = used
+	}
+
+	return pinned, nil
+}
+
+// DeferredDestroyPending returns the snapshots marked for deferred destruction, `zfs destroy -d`, that still exist
+// along with their dependent clones. Promoting or destroying the clones, and releasing any holds, lets zfs free them.
+func (z Zpool) DeferredDestroyPending() (pending []*Snapshot, err error) {
+
+	pending = make([]*Snapshot, 0)
+
+	//  zfs get -t snapshot -Hpro name,property,value guid,createtxg,creation,defer_destroy,clones tank
+	props, names, err := z.getProperties([]string{"-t", "snapshot", "-r"}, "guid,createtxg,creation,defer_destroy,clones", z.Name)
+	if err != nil {
+		return pending, err
+	}
+
+	for _, name := range names {
+		if props[name]["defer_destroy"] != "on" {
+			continue
+		}
+		ds := &Snapshot{Name: name}
+		for property, value := range props[name] {
+			if err := ds.setProperty(property, value); err != nil {
+				return pending, err
+			}
+		}
+		pending = append(pending, ds)
+	}
+
+	return pending, nil
+}
+
+// CreateSnapshots creates the snapshots atomically with a single `zfs snapshot` command, so they share a createtxg.
+// Every name is validated before running the command so a bad name doesn't leave a partial set.
+func (z *Zpool) CreateSnapshots(names []string) (l []Snapshot, err error) {
+
+	l = make([]Snapshot, 0, len(names))
+
+	if len(names) == 0 {
+		return l, errors.New("no snapshots given")
+	}
+
+	// validate all names before executing
+	for _, name := range names {
+		parts := strings.Split(name, "@")
+		if len(parts) != 2 || len(parts[1]) == 0 || !z.owns(name) {
+			return l, errors.Errorf("snapshot %q cannot be created on zpool %q", name, z.Name)
+		}
+	}
+
+	// zfs snapshot tank/a@snap tank/b@snap
+	cmd := command(zfsPath, append([]string{"snapshot"}, names...)...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// report the snapshot named in zfs's error output
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			for _, name := range names {
+				if strings.Contains(string(exitErr.Stderr), fmt.Sprintf("'%s'", name)) {
+					return l, errors.Wrapf(err, "unable to create snapshot %q: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+				}
+			}
+		}
+		return l, errors.Wrapf(err, "unable to create snapshots %q", names)
+	}
+
+	// retrieve the newly created snapshots
+	for _, name := range names {
+		snap, err := z.GetSnapshot(name)
+		if err != nil {
+			return l, errors.Wrapf(err, "unable to retrieve snapshot %q after creation", name)
+		}
+		l = append(l, snap)
+	}
+
+	return l, nil
+}
+
+// FilesystemsSinceTxg will return an array of filesystems created after the given txg.
+func (z Zpool) FilesystemsSinceTxg(txg int64) (filesystems []*Filesystem, err error) {
+
+	filesystems = make([]*Filesystem, 0)
+
+	l, err := z.ListFilesystems()
+	if err != nil {
+		return filesystems, err
+	}
+
+	for _, fs := range l {
+		if fs.CreateTxg > txg {
+			filesystems = append(filesystems, fs)
+		}
+	}
+
+	return filesystems, nil
+}
+
+// SnapshotsSinceTxg will return an array of snapshots created after the given txg.
+func (z Zpool) SnapshotsSinceTxg(txg int64) (snapshots []*Snapshot, err error) {
+
+	snapshots = make([]*Snapshot, 0)
+
+	l, err := z.ListSnapshots()
+	if err != nil {
+		return snapshots, err
+	}
+
+	for _, ds := range l {
+		if ds.CreateTxg > txg {
+			snapshots = append(snapshots, ds)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// SnapshotExists will return true or false if the snapshot name is found on the zpool.
+// Only snapshots are matched, a filesystem with the same name doesn't count.
+func (z Zpool) SnapshotExists(name string) bool {
+
+	// short circuit to false if name isn't a snapshot on the zpool
+	parts := strings.Split(name, "@")
+	if len(parts) != 2 || len(parts[1]) == 0 || !z.owns(name) {
+		return false
+	}
+
+	// zfs get -t snapshot -Ho value name tank/a@snap
+	_, err := z.run(command(zfsPath, "get", "-t", "snapshot", "-Ho", "value", "name", name))
+	if err != nil {
+		return false
+	}
+	return true
+}
+
+// FindSnapshots will return an array of snapshots of the filesystem whose name after the @ sign matches the pattern.
+// The pattern is a glob as used by path.Match, e.g. "auto-*". A pattern without glob characters matches as a prefix.
+func (z Zpool) FindSnapshots(filesystem, namePattern string) (snapshots []*Snapshot, err error) {
+
+	snapshots = make([]*Snapshot, 0)
+
+	// validate the pattern before listing
+	if _, err := path.Match(namePattern, ""); err != nil {
+		return snapshots, errors.Wrapf(err, "bad snapshot name pattern %q", namePattern)
+	}
+
+	l, err := z.SnapshotsOf(Filesystem{Name: filesystem})
+	if err != nil {
+		return snapshots, err
+	}
+
+	// a pattern without glob characters is a prefix
+	if strings.ContainsAny(namePattern, "*?[\\") == false {
+		namePattern += "*"
+	}
+
+	for _, ds := range l {
+		if ok, _ := path.Match(namePattern, ds.ShortName()); ok {
+			snapshots = append(snapshots, ds)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// ListAll will return maps of the filesystems, volumes and snapshots on the zpool.
+// A single zfs command is run, which gives a consistent point-in-time view of the zpool.
+// Snapshot comments aren't fetched, use ListSnapshots for them.
+func (z Zpool) ListAll() (filesystems Filesystems, volumes Volumes, snapshots Snapshots, err error) {
+
+	// make maps
+	filesystems = make(Filesystems, 0)
+	volumes = make(Volumes, 0)
+	snapshots = make(Snapshots, 0)
+
+	// zfs get -t filesystem,volume,snapshot -Hpro name,property,value type,volsize,creation,name,origin,guid,createtxg,mountpoint,... tank
+	// the type of each dataset is needed before the dataset can be created
+	props, names, err := z.getProperties([]string{"-t", "filesystem,volume,snapshot", "-r"}, "type,volsize,creation,"+strings.Join(filesystemProperties, ","), z.Name)
+	if err != nil {
+		return filesystems, volumes, snapshots, err
+	}
+
+	// demultiplex datasets by type
+	for _, name := range names {
+		var set func(property, value string) error
+		switch props[name]["type"] {
+		case "filesystem":
+			ds := &Filesystem{Name: name}
+			filesystems[name], set = ds, ds.setProperty
+		case "volume":
+			ds := &Volume{Name: name}
+			volumes[name], set = ds, ds.setProperty
+		case "snapshot":
+			ds := &Snapshot{Name: name}
+			snapshots[name], set = ds, ds.setProperty
+		default:
+			continue
+		}
+
+		for property, value := range props[name] {
+			if err := set(property, value); err != nil {
+				return filesystems, volumes, snapshots, err
+			}
+		}
+	}
+
+	return filesystems, volumes, snapshots, nil
+}
+
+// parseProperties parses the output of `zfs get -H -o name,property,value` into a map of property values per dataset name.
+// The dataset names are also returned in the order they were found. A line that isn't three tab separated fields is an error.
+func parseProperties(out []byte) (props map[string]map[string]string, names []string, err error) {
+
+	props = make(map[string]map[string]string)
+	names = make([]string, 0)
+
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		// skip blank lines and trailing carriage returns, they would create phantom datasets
+		line := strings.TrimRight(in.Text(), "\r")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		fields, err := splitFields(line, 3)
+		if err != nil {
+			return props, names, err
+		}
+		name, property, value := fields[0], fields[1], fields[2]
+		if len(name) == 0 {
+			return props, names, errors.Errorf("unable to parse zfs output line %q: empty dataset name", line)
+		}
+
+		// check if name already exists in map, if not create it
+		if _, ok := props[name]; !ok {
+			props[name] = make(map[string]string)
+			names = append(names, name)
+		}
+		props[name][property] = value
+	}
+
+	return props, names, nil
+}
+
+// splitFields splits a line of tab separated `zfs get -H` output into exactly n fields, so output with columns
+// added or missing is an error naming the line rather than misparsed.
+func splitFields(line string, n int) ([]string, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+	if len(fields) != n {
+		return fields, errors.Errorf("unable to parse zfs output line %q: expected %d tab separated fields, found %d", line, n, len(fields))
+	}
+	return fields, nil
+}
+
+// sortableProperties are the properties ListFilesystemsSorted lets zfs sort by.
+var sortableProperties = map[string]bool{
+	"name":              true,
+	"used":              true,
+	"available":         true,
+	"referenced":        true,
+	"logicalused":       true,
+	"logicalreferenced": true,
+	"written":           true,
+	"quota":             true,
+	"refquota":          true,
+	"reservation":       true,
+	"compressratio":     true,
+	"creation":          true,
+	"createtxg":         true,
+	"guid":              true,
+	"mountpoint":        true,
+}
+
+// ListFilesystemsSorted will return an array of filesystems on the zpool sorted by the property.
+// The sorting is done by zfs with `zfs list -s` or `-S` when descending.
+func (z Zpool) ListFilesystemsSorted(property string, descending bool) (filesystems []*Filesystem, err error) {
+
+	filesystems = make([]*Filesystem, 0)
+
+	if !sortableProperties[property] {
+		return filesystems, errors.Errorf("unable to sort filesystems by property %q", property)
+	}
+
+	sortFlag := "-s"
+	if descending {
+		sortFlag = "-S"
+	}
+
+	// zfs list -t filesystem -Hpr -o name,origin,guid,createtxg,mountpoint,usedbysnapshots,... -S used tank
+	columns := filesystemProperties
+	cmd := command(zfsPath, "list", "-t", "filesystem", "-Hpr", "-o", strings.Join(columns, ","), sortFlag, property, z.Name)
+
+	// execute command
+	out, err := z.run(cmd)
+	if err != nil {
+		cmdString := getCommandString(cmd)
+		return filesystems, errors.Wrapf(err, "unable to run command %q", cmdString)
+	}
+
+	// parse tab separated columns in the sorted order
+	in := bufio.NewScanner(bytes.NewReader(out))
+	for in.Scan() {
+		line := in.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		fields, err := splitFields(line, len(columns))
+		if err != nil {
+			return filesystems, err
+		}
+
+		ds := &Filesystem{}
+		for i, property := range columns {
+			if err := ds.setProperty(property, fields[i]); err != nil {
+				return filesystems, err
+			}
+		}
+		filesystems = append(filesystems, ds)
+	}
+
+	return filesystems, nil
+}
+
+// TypeOf will return the type of the dataset, one of filesystem, volume, snapshot or bookmark.
+func (z Zpool) TypeOf(name string) (string, error) {
+
+	// dataset name should start with zpool name
+	if len(name) == 0 || !z.owns(name) {
+		return "", errors.Errorf("bad request for dataset %q on zpool %q", name, z.Name)
+	}
+
+	// zfs get -Ho value type tank/a
+	cmd := command(zfsPath, "get", "-Ho", "value", "type", name)
+	out, err := z.run(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "dataset %q not found", name)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// mountOptions are the temporary mount options accepted by MountWithOptions.
+var mountOptions = map[string]bool{
+	"ro": true, "rw": true,
+	"exec": true, "noexec": true,
+	"suid": true, "nosuid": true,
+	"dev": true, "nodev": true,
+	"atime": true, "noatime": true,
+	"relatime": true, "norelatime": true,
+	"xattr": true, "noxattr": true,
+	"nbmand": true, "nonbmand": true,
+}
+
+// MountWithOptions mounts the filesystem with temporary mount options, e.g. ro and noexec.
+// The options override the filesystem's properties for this mount only and are not persisted.
+func (z *Zpool) MountWithOptions(name string, options []string) error {
+
+	// filesystem name should start with zpool name
+	if len(name) == 0 || strings.Contains(name, "@") || !z.owns(name) {
+		return errors.Errorf("filesystem %q cannot be mounted on zpool %q", name, z.Name)
+	}
+
+	// validate options
+	for _, o := range options {
+		if !mountOptions[o] {
+			return errors.Errorf("unknown mount option %q", o)
+		}
+	}
+
+	// zfs mount -o ro,noexec tank/a
+	args := []string{"mount"}
+	if len(options) > 0 {
+		args = append(args, "-o", strings.Join(options, ","))
+	}
+	cmd := command(zfsPath, append(args, name)...)
+
+	// run command
+	if _, err := z.run(cmd); err != nil {
+		// known ways to fail
+		// 1. filesystem is already mounted
+		// 2. filesystem doesn't exist
+		// 3. zfs fails
+		return errors.Wrapf(err, "unable to mount filesystem %q", name)
+	}
+
+	return nil
+}
+
+// SnapshotFilesystems creates a snapshot named suffix on each filesystem atomically, e.g. tank/a@suffix and tank/b@suffix.
+// The snapshots share a createtxg, see CreateSnapshots.
+func (z *Zpool) SnapshotFilesystems(filesystems []string, suffix string) ([]Snapshot, error) {
+
+	// suffix is the part after the @ sign
+	if len(suffix) == 0 || strings.ContainsAny(suffix, "@/") {
+		return make([]Snapshot, 0), errors.Errorf("bad snapshot suffix %q", suffix)
+	}
+
+	names := make([]string, 0, len(filesystems))
+	for _, fs := range filesystems {
+		names = append(names, fmt.Sprintf("%s@%s", fs, suffix))
+	}
+
+	return z.CreateSnapshots(names)
 }
@@ -3,32 +3,50 @@ package zfs
 import (
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var zpoolName string = "test_zpool"
 var z Zpool
 
+// zpoolErr is why the test zpool can't be used, the tests needing it are skipped then.
+var zpoolErr error
+
 func TestMain(m *testing.M) {
-	var err error
 
-	z, err = New(zpoolName)
-	if err != nil {
-		log.Fatalf("zpool %q doesn't exist", zpoolName)
+	z, zpoolErr = New(zpoolName)
+	if zpoolErr != nil {
+		log.Printf("zpool %q doesn't exist, skipping the tests needing it", zpoolName)
 	}
 
 	m.Run()
 }
 
+// needsZpool skips the test when the test zpool doesn't exist, so the parsing tests still run without zfs.
+func needsZpool(t *testing.T) {
+	t.Helper()
+	if zpoolErr != nil {
+		t.Skipf("zpool %q doesn't exist, received %+v", zpoolName, zpoolErr)
+	}
+}
+
 func TestNew(t *testing.T) {
+	needsZpool(t)
 
 	// bogus case
 	{
 		name := "bogus"
 		_, err := New(name)
-		if err == nil {
-			t.Errorf("%s zpool shouldn't exist", name)
+		if errors.Cause(err) != ErrZpoolNotFound {
+			t.Errorf("%s zpool shouldn't exist, received %+v", name, err)
 		}
 	}
 
@@ -43,6 +61,7 @@ func TestNew(t *testing.T) {
 }
 
 func TestCreateSnapshot(t *testing.T) {
+	needsZpool(t)
 
 	var err error
 
@@ -64,9 +83,233 @@ func TestCreateSnapshot(t *testing.T) {
 		t.Logf("created new snapshot %s, guid: %s, createtxg: %d\n", snap.Name, snap.GUID, snap.CreateTxg)
 	}
 
+	// existing snapshot case
+	if _, err := z.CreateSnapshot(snapName); errors.Cause(err) != ErrDatasetExists {
+		t.Errorf("creating existing snapshot %q should fail with %v, received %+v", snapName, ErrDatasetExists, err)
+	}
+}
+
+func TestIsAncestorSnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with 2 snapshots
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 2; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	// clone the first snapshot
+	clone, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: snaps[0].Name})
+	if err != nil {
+		t.Errorf("failed to create new clone of %q, received %+v", snaps[0].Name, err)
+	}
+
+	cases := []struct {
+		snapshot, filesystem string
+		ancestor             bool
+	}{
+		{snaps[1].Name, fs.Name, true},     // own snapshot
+		{snaps[0].Name, clone.Name, true},  // origin snapshot
+		{snaps[1].Name, clone.Name, false}, // diverged after the clone
+	}
+	for _, c := range cases {
+		if ok, err := z.IsAncestorSnapshot(c.snapshot, c.filesystem); err != nil || ok != c.ancestor {
+			t.Errorf("snapshot %q ancestor of %q is %t, expected %t, received %+v", c.snapshot, c.filesystem, ok, c.ancestor, err)
+		}
+	}
+}
+
+func TestIsAncestorSnapshotOrigin(t *testing.T) {
+
+	// tank/clone is cloned from tank/fs@s1, tank/fs@s2 was taken after it
+	getFilesystem := "zfs get -t filesystem -Hpo property,value " + strings.Join(filesystemProperties, ",") + " "
+	getSnapshot := "zfs get -t snapshot -s " + snapshotSources + " -Hpo property,value name,guid,createtxg,creation," + commentProperty + " "
+	filesystem := func(name, origin string) string {
+		return fmt.Sprintf("name\t%s\norigin\t%s\nguid\t1\ncreatetxg\t1\nmountpoint\t/%s\nusedbysnapshots\t0\nusedbydataset\t0\n"+
+			"usedbychildren\t0\nusedbyrefreservation\t0\nquota\t0\ncompressratio\t1.00\nrefcompressratio\t1.00\n", name, origin, name)
+	}
+	snapshot := func(name string, txg int) string {
+		return fmt.Sprintf("name\t%s\nguid\t%d\ncreatetxg\t%d\ncreation\t%d\n", name, txg, txg, txg)
+	}
+	fake := Zpool{Name: "tank", Runner: fakeRunner{
+		getFilesystem + "tank/fs":     filesystem("tank/fs", "-"),
+		getFilesystem + "tank/clone":  filesystem("tank/clone", "tank/fs@s1"),
+		getSnapshot + "tank/fs@s1":    snapshot("tank/fs@s1", 10),
+		getSnapshot + "tank/fs@s2":    snapshot("tank/fs@s2", 20),
+		getSnapshot + "tank/clone@c1": snapshot("tank/clone@c1", 30),
+		getSnapshot + "tank/other@s1": snapshot("tank/other@s1", 5),
+		getFilesystem + "tank/other":  filesystem("tank/other", "-"),
+	}}
+
+	cases := []struct {
+		snapshot, filesystem string
+		expected             bool
+	}{
+		{"tank/clone@c1", "tank/clone", true},
+		{"tank/fs@s1", "tank/clone", true},
+		{"tank/fs@s2", "tank/clone", false},
+		{"tank/other@s1", "tank/clone", false},
+	}
+	for _, c := range cases {
+		if ok, err := fake.IsAncestorSnapshot(c.snapshot, c.filesystem); err != nil || ok != c.expected {
+			t.Errorf("%q should be an ancestor of %q: %t, found %t, received %+v", c.snapshot, c.filesystem, c.expected, ok, err)
+		}
+	}
+}
+
+func TestSnapshotsOfMany(t *testing.T) {
+	needsZpool(t)
+
+	// create 2 new filesystems with 2 snapshots each, and one without
+	names := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		fs, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())})
+		if err != nil {
+			t.Errorf("failed to create new filesystem, received %+v", err)
+		}
+		names = append(names, fs.Name)
+		for j := 0; i < 2 && j < 2; j++ {
+			if _, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())); err != nil {
+				t.Errorf("failed to create new snapshot on %q", fs.Name)
+			}
+		}
+	}
+
+	groups, err := z.SnapshotsOfMany(names)
+	if err != nil {
+		t.Errorf("unable to get snapshots of %v, received %+v", names, err)
+	} else {
+		for i, name := range names {
+			expected := 2
+			if i == 2 {
+				expected = 0
+			}
+			if snapshots, ok := groups[name]; !ok || len(snapshots) != expected {
+				t.Errorf("filesystem %q has %d snapshots, expected %d", name, len(snapshots), expected)
+			}
+		}
+		if len(groups) != len(names) {
+			t.Errorf("found %d groups, expected %d", len(groups), len(names))
+		}
+	}
+
+	// bad filesystem case
+	if _, err := z.SnapshotsOfMany([]string{"bogus/fs"}); err == nil {
+		t.Errorf("snapshots of a filesystem of another zpool should fail")
+	}
+}
+
+func TestSnapshotsByFilesystem(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 3 snapshots on the new filesystem
+	for i := 0; i < 3; i++ {
+		snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+		if _, err := z.CreateSnapshot(snapName); err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+	}
+
+	groups, err := z.SnapshotsByFilesystem()
+	if err != nil {
+		t.Errorf("unable to group snapshots on %s, received %+v", z.Name, err)
+	} else {
+		snapshots := groups[fs.Name]
+		if len(snapshots) != 3 {
+			t.Errorf("filesystem %q has %d snapshots, expected 3", fs.Name, len(snapshots))
+		}
+		for i := 1; i < len(snapshots); i++ {
+			if snapshots[i-1].CreateTxg > snapshots[i].CreateTxg {
+				t.Errorf("snapshots of %q aren't sorted by createtxg", fs.Name)
+			}
+		}
+	}
+}
+
+func TestEnsureSnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// ensure twice returns the same snapshot
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	first, err := z.EnsureSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to ensure snapshot %q, received %+v", snapName, err)
+	}
+	second, err := z.EnsureSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to ensure existing snapshot %q, received %+v", snapName, err)
+	} else if second.GUID != first.GUID {
+		t.Errorf("ensured snapshot %q has guid %s, expected %s", snapName, second.GUID, first.GUID)
+	}
+
+	// non-existing filesystem case
+	bogus := fmt.Sprintf("%s/bogus_%s@snap", z.Name, uuid.New())
+	if _, err := z.EnsureSnapshot(bogus); err == nil {
+		t.Errorf("ensuring snapshot %q should fail", bogus)
+	}
+}
+
+func TestCreateUniqueSnapshot(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// the second and third snapshots get a suffix
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	for _, expected := range []string{snapName, snapName + "-1", snapName + "-2"} {
+		snap, err := z.CreateUniqueSnapshot(snapName)
+		if err != nil {
+			t.Errorf("failed to create unique snapshot %q, received %+v", snapName, err)
+		} else if snap.Name != expected {
+			t.Errorf("created snapshot %q, expected %q", snap.Name, expected)
+		}
+	}
+
+	// non-existing filesystem case
+	bogus := fmt.Sprintf("%s/bogus_%s@snap", z.Name, uuid.New())
+	if _, err := z.CreateUniqueSnapshot(bogus); err == nil {
+		t.Errorf("creating unique snapshot %q should fail", bogus)
+	}
 }
 
 func TestCreateFilesystem(t *testing.T) {
+	needsZpool(t)
 	// create a new filesystem
 	var snap Snapshot // save for when creating a clone filesystem
 	var err error
@@ -102,7 +345,95 @@ func TestCreateFilesystem(t *testing.T) {
 	}
 }
 
+// fakePool runs create, destroy, list and get of filesystems on an in-memory set of dataset names.
+// afterCreate is called after a create, outside the lock, to run in the window before the filesystem is retrieved.
+type fakePool struct {
+	mu          sync.Mutex
+	datasets    map[string]bool
+	afterCreate func(name string)
+}
+
+func (p *fakePool) Run(cmd *exec.Cmd) ([]byte, error) {
+	args := cmd.Args[1:]
+	name := args[len(args)-1]
+	absent := &exec.ExitError{Stderr: []byte(fmt.Sprintf("cannot open '%s': dataset does not exist\n", name))}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch args[0] {
+	case "create":
+		if p.datasets[name] {
+			return nil, &exec.ExitError{Stderr: []byte(fmt.Sprintf("cannot create '%s': dataset already exists\n", name))}
+		}
+		p.datasets[name] = true
+		if p.afterCreate != nil {
+			p.mu.Unlock()
+			p.afterCreate(name)
+			p.mu.Lock()
+		}
+		return nil, nil
+	case "destroy":
+		if !p.datasets[name] {
+			return nil, absent
+		}
+		delete(p.datasets, name)
+		return nil, nil
+	case "list":
+		if !p.datasets[name] {
+			return nil, absent
+		}
+		return []byte(name + "\n"), nil
+	case "get":
+		if !p.datasets[name] {
+			return nil, absent
+		}
+		return []byte(fmt.Sprintf("name\t%s\norigin\t-\nguid\t1\ncreatetxg\t1\nmountpoint\t/%s\n", name, name)), nil
+	}
+	return nil, errors.Errorf("unexpected command %q", getCommandString(cmd))
+}
+
+func TestCreateFilesystemRemoved(t *testing.T) {
+
+	// a filesystem destroyed between its creation and retrieval
+	pool := &fakePool{datasets: map[string]bool{"tank": true}}
+	fake := Zpool{Name: "tank", Runner: pool}
+	pool.afterCreate = func(name string) {
+		if err := fake.DestroyFilesystem(name); err != nil {
+			t.Errorf("unable to destroy filesystem %q, received %+v", name, err)
+		}
+	}
+	if _, err := fake.CreateFilesystem(Filesystem{Name: "tank/a"}); errors.Cause(err) != ErrRemovedAfterCreate {
+		t.Errorf("creating filesystem removed after creation should fail with %v, received %+v", ErrRemovedAfterCreate, err)
+	}
+
+	// creates racing destroys of the same filesystems, run with -race
+	pool = &fakePool{datasets: map[string]bool{"tank": true}}
+	fake = Zpool{Name: "tank", Runner: pool}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("tank/fs%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			// the create itself may fail on a filesystem not destroyed yet, a failed retrieval must be ErrRemovedAfterCreate
+			for j := 0; j < 50; j++ {
+				if _, err := fake.CreateFilesystem(Filesystem{Name: name}); err != nil && strings.Contains(err.Error(), "unable to retrieve") {
+					t.Errorf("retrieving filesystem %q removed after creation should fail with %v, received %+v", name, ErrRemovedAfterCreate, err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				fake.DestroyFilesystem(name)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestExistsByName(t *testing.T) {
+	needsZpool(t)
 
 	// get all filesystems
 	l, err := z.ListFilesystems()
@@ -112,30 +443,39 @@ func TestExistsByName(t *testing.T) {
 
 	// working name case
 	for _, ds := range l {
-		if exists := z.ExistsByName(ds.Name); !exists {
-			t.Errorf("dataset %q doesn't exist", ds.Name)
+		if exists, err := z.ExistsByName(ds.Name); !exists || err != nil {
+			t.Errorf("dataset %q doesn't exist, received %+v", ds.Name, err)
 		}
 	}
 
 	// bogus name case
 	{
 		name := "bogus/bogus"
-		if exists := z.ExistsByName(name); exists {
-			t.Errorf("dataset %q should not exist", name)
+		if exists, err := z.ExistsByName(name); exists || err != nil {
+			t.Errorf("dataset %q should not exist, received %+v", name, err)
+		}
+	}
+
+	// absent name on the zpool case
+	{
+		name := fmt.Sprintf("%s/bogus_%s", z.Name, uuid.New())
+		if exists, err := z.ExistsByName(name); exists || err != nil {
+			t.Errorf("dataset %q should not exist, received %+v", name, err)
 		}
 	}
 
 	// empty name case
 	{
 		name := ""
-		if exists := z.ExistsByName(name); exists {
-			t.Errorf("dataset %q should not exist", name)
+		if exists, err := z.ExistsByName(name); exists || err != nil {
+			t.Errorf("dataset %q should not exist, received %+v", name, err)
 		}
 	}
 
 }
 
 func TestExistsByGUID(t *testing.T) {
+	needsZpool(t)
 
 	// get zpool filesystem
 	fs, err := z.GetFilesystem(zpoolName)
@@ -151,6 +491,17 @@ func TestExistsByGUID(t *testing.T) {
 		}
 	}
 
+	// check guid of zpool filesystem scoped by type
+	{
+		guid := fs.GUID
+		if exists := z.ExistsByGUID(guid, "filesystem"); !exists {
+			t.Errorf("filesystem %q with guid %q doesn't exist", fs.Name, guid)
+		}
+		if exists := z.ExistsByGUID(guid, "snapshot"); exists {
+			t.Errorf("filesystem %q with guid %q should not exist as a snapshot", fs.Name, guid)
+		}
+	}
+
 	// bogus guid case
 	{
 		guid := "bogus"
@@ -170,6 +521,7 @@ func TestExistsByGUID(t *testing.T) {
 }
 
 func TestListFilesystems(t *testing.T) {
+	needsZpool(t)
 
 	// get all filesystems
 	l, err := z.ListFilesystems()
@@ -183,7 +535,118 @@ func TestListFilesystems(t *testing.T) {
 	}
 }
 
+func TestListFilesystemNames(t *testing.T) {
+	needsZpool(t)
+
+	names, err := z.ListFilesystemNames()
+	if err != nil {
+		t.Errorf("unable to get filesystem names on %s, received %+v", z.Name, err)
+		return
+	}
+
+	// the same filesystems as the full listing, in sorted order
+	l, err := z.ListFilesystems()
+	if err != nil {
+		t.Errorf("unable to get filesystems on %s, received %+v", z.Name, err)
+	} else if len(names) != len(l) {
+		t.Errorf("found %d filesystem names, expected %d", len(names), len(l))
+	}
+	for i, name := range names {
+		if _, ok := l[name]; !ok {
+			t.Errorf("filesystem %q not found in full listing", name)
+		}
+		if i > 0 && names[i-1] >= name {
+			t.Errorf("filesystem names aren't sorted at %q", name)
+		}
+	}
+}
+
+func TestListFilesystemsProps(t *testing.T) {
+	needsZpool(t)
+
+	// get all filesystems with extra properties
+	l, err := z.ListFilesystemsProps([]string{"used", "available"})
+	if err != nil {
+		t.Errorf("unable to get filesystems on %s, received %+v", z.Name, err)
+	} else {
+		for _, ds := range l {
+			if _, ok := ds.Properties["available"]; !ok {
+				t.Errorf("filesystem %q is missing requested property %q", ds.Name, "available")
+			}
+			t.Logf("found filesystem %s, used: %s, available: %s\n", ds.Name, ds.Properties["used"], ds.Properties["available"])
+		}
+	}
+
+	// bad property name case
+	if _, err := z.ListFilesystemsProps([]string{"used,available"}); err == nil {
+		t.Errorf("listing with a bad property name should fail")
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q, received %+v", fs.Name, err)
+	}
+
+	// label is sanitized
+	name := SnapshotName(fs.Name, "daily backup/a@b")
+	if !strings.HasPrefix(name, fs.Name+"@daily-backup-a-b-") {
+		t.Errorf("snapshot name %q isn't sanitized", name)
+	}
+
+	// the names are valid snapshot names
+	for _, name := range []string{name, SnapshotNameUUID(fs.Name, "daily backup")} {
+		snap, err := z.CreateSnapshot(name)
+		if err != nil {
+			t.Errorf("failed to create new snapshot %q, received %+v", name, err)
+		} else {
+			t.Logf("created new snapshot %s, guid: %s, createtxg: %d\n", snap.Name, snap.GUID, snap.CreateTxg)
+		}
+	}
+}
+
+func TestFilesystemsWithProperty(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a user property
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	id := uuid.New().String()
+	if err := z.SetProperty(fs.Name, "user:audit", id); err != nil {
+		t.Errorf("unable to set user:audit on %q, received %+v", fs.Name, err)
+	}
+
+	// only the tagged filesystem matches
+	l, err := z.FilesystemsWithProperty("user:audit", id)
+	if err != nil {
+		t.Errorf("unable to find filesystems with user:audit=%s, received %+v", id, err)
+	} else if len(l) != 1 || l[0].Name != fs.Name {
+		t.Errorf("found %d filesystems with user:audit=%s, expected only %q", len(l), id, fs.Name)
+	}
+
+	// unset property case, the zpool root has no user:audit
+	l, err = z.FilesystemsWithProperty("user:audit", "-")
+	if err != nil {
+		t.Errorf("unable to find filesystems without user:audit, received %+v", err)
+	} else if len(l) == 0 || l[0].Name != z.Name {
+		t.Errorf("zpool root %q should not have user:audit set", z.Name)
+	}
+}
+
 func TestListSnapshots(t *testing.T) {
+	needsZpool(t)
 
 	// get all snapshots
 	l, err := z.ListSnapshots()
@@ -198,6 +661,7 @@ func TestListSnapshots(t *testing.T) {
 }
 
 func TestClonesOf(t *testing.T) {
+	needsZpool(t)
 
 	var err error
 
@@ -249,6 +713,7 @@ func TestClonesOf(t *testing.T) {
 }
 
 func TestSnapshotsOf(t *testing.T) {
+	needsZpool(t)
 
 	var err error
 
@@ -288,3 +753,1154 @@ func TestSnapshotsOf(t *testing.T) {
 		}
 	}
 }
+
+func TestDestroyPreview(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	if _, err = z.CreateSnapshot(snapName); err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// recursive preview should list the filesystem and its snapshot
+	l, err := z.DestroyPreview(fs.Name, true)
+	if err != nil {
+		t.Errorf("unable to preview destroy of %q, received %+v", fs.Name, err)
+	} else if len(l) != 2 {
+		t.Errorf("expected 2 datasets in destroy preview of %q, found %v", fs.Name, l)
+	}
+
+	// filesystem should still exist after the dry run
+	if exists, _ := z.ExistsByName(fs.Name); !exists {
+		t.Errorf("filesystem %q should still exist after destroy preview", fs.Name)
+	}
+
+	// bogus name case
+	if _, err := z.DestroyPreview("bogus/bogus", false); err == nil {
+		t.Errorf("destroy preview of bogus dataset should fail")
+	}
+}
+
+func TestCloneAndMount(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// clone and mount the snapshot
+	id := uuid.New()
+	cloneName := fmt.Sprintf("%s/new_clonefs_%s", z.Name, id)
+	mountpoint := fmt.Sprintf("/tmp/new_clonefs_%s", id)
+	clone, err := z.CloneAndMount(snap.Name, cloneName, mountpoint)
+	if err != nil {
+		t.Errorf("failed to clone and mount %q at %q, received %+v", cloneName, mountpoint, err)
+	} else {
+		t.Logf("created new clone filesystem %s, origin: %s, mountpoint: %s\n", clone.Name, clone.Origin, clone.Mountpoint)
+		if clone.Mountpoint != mountpoint {
+			t.Errorf("clone %q has mountpoint %q, expected %q", clone.Name, clone.Mountpoint, mountpoint)
+		}
+	}
+
+	// relative mountpoint case
+	if _, err := z.CloneAndMount(snap.Name, fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), "relative"); err == nil {
+		t.Errorf("clone with relative mountpoint should fail")
+	}
+
+	// failed mount case, a regular file can't be mounted on and the clone is destroyed
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("file"), 0644); err != nil {
+		t.Errorf("unable to write file %q, received %+v", file, err)
+	}
+	failedName := fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New())
+	if _, err := z.CloneAndMount(snap.Name, failedName, file); err == nil {
+		t.Errorf("clone mounted on file %q should fail", file)
+	}
+	if exists, _ := z.ExistsByName(failedName); exists {
+		t.Errorf("clone %q should be destroyed after its mount failed", failedName)
+	}
+}
+
+func TestCloneWithQuota(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// clone the snapshot with a quota
+	cloneName := fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New())
+	clone, err := z.CloneWithQuota(snap.Name, cloneName, 64*1024*1024)
+	if err != nil {
+		t.Errorf("failed to clone %q with quota, received %+v", cloneName, err)
+	} else {
+		t.Logf("created new clone filesystem %s, origin: %s, quota: %d\n", clone.Name, clone.Origin, clone.Quota)
+		if clone.Quota != 64*1024*1024 {
+			t.Errorf("clone %q has quota %d, expected %d", clone.Name, clone.Quota, 64*1024*1024)
+		}
+	}
+
+	// zero quota case
+	if _, err := z.CloneWithQuota(snap.Name, fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), 0); err == nil {
+		t.Errorf("clone with zero quota should fail")
+	}
+
+	// bad snapshot name case
+	if _, err := z.CloneWithQuota(fs.Name, fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), 1024*1024); err == nil {
+		t.Errorf("clone of filesystem %q should fail", fs.Name)
+	}
+}
+
+func TestCreateEphemeralClone(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// clone the snapshot and clean it up
+	cloneName := fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New())
+	clone, cleanup, err := z.CreateEphemeralClone(snap.Name, cloneName)
+	if err != nil {
+		t.Errorf("failed to create ephemeral clone %q, received %+v", cloneName, err)
+	} else {
+		t.Logf("created new ephemeral clone %s, origin: %s\n", clone.Name, clone.Origin)
+		if err := cleanup(); err != nil {
+			t.Errorf("failed to clean up ephemeral clone %q, received %+v", cloneName, err)
+		}
+		if exists, _ := z.ExistsByName(cloneName); exists {
+			t.Errorf("ephemeral clone %q should not exist after clean up", cloneName)
+		}
+
+		// a second cleanup does nothing
+		if err := cleanup(); err != nil {
+			t.Errorf("second clean up of ephemeral clone %q should not fail, received %+v", cloneName, err)
+		}
+	}
+
+	// bad snapshot name case
+	if _, _, err := z.CreateEphemeralClone(fs.Name, fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New())); err == nil {
+		t.Errorf("ephemeral clone of filesystem %q should fail", fs.Name)
+	}
+}
+
+func TestDeferredDestroyPending(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem and clone it
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+	cloneName := fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New())
+	if _, err := z.CreateFilesystem(Filesystem{Name: cloneName, Origin: snap.Name}); err != nil {
+		t.Errorf("failed to clone %q, received %+v", cloneName, err)
+	}
+
+	// deferred destroy of the origin snapshot leaves it pending
+	if _, err := execAndLog(exec.Command(zfsPath, "destroy", "-d", snap.Name)); err != nil {
+		t.Errorf("failed to defer destroy of %q, received %+v", snap.Name, err)
+	}
+
+	pending, err := z.DeferredDestroyPending()
+	if err != nil {
+		t.Errorf("unable to list deferred destroy pending snapshots, received %+v", err)
+	}
+	found := false
+	for _, s := range pending {
+		if s.Name == snap.Name {
+			found = true
+			if len(s.Clones) != 1 || s.Clones[0] != cloneName {
+				t.Errorf("snapshot %q should have clone %q, found %v", s.Name, cloneName, s.Clones)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("snapshot %q should be pending deferred destroy", snap.Name)
+	}
+}
+
+func TestDestructionOrder(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a child, a snapshot and a clone of the snapshot under the child
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	child, err := z.CreateFilesystem(Filesystem{Name: fs.Name + "/child"})
+	if err != nil {
+		t.Errorf("failed to create child filesystem of %q", fs.Name)
+	}
+	snap, err := z.CreateSnapshot(fs.Name + "@snap")
+	if err != nil {
+		t.Errorf("failed to create snapshot of %q", fs.Name)
+	}
+	if _, err := z.CreateFilesystem(Filesystem{Name: child.Name + "/clone", Origin: snap.Name}); err != nil {
+		t.Errorf("failed to clone %q, received %+v", snap.Name, err)
+	}
+
+	order, err := z.DestructionOrder(fs.Name)
+	if err != nil {
+		t.Errorf("unable to get destruction order of %q, received %+v", fs.Name, err)
+	}
+	t.Logf("destruction order of %s is %v", fs.Name, order)
+
+	// destroying in order succeeds
+	for _, name := range order {
+		if strings.Contains(name, "@") {
+			err = z.DestroySnapshot(name)
+		} else {
+			err = z.DestroyFilesystem(name)
+		}
+		if err != nil {
+			t.Errorf("failed to destroy %q in order %v, received %+v", name, order, err)
+		}
+	}
+
+	// non-existing dataset case
+	bogus := fmt.Sprintf("%s/bogus_%s", z.Name, uuid.New())
+	if _, err := z.DestructionOrder(bogus); err == nil {
+		t.Errorf("destruction order of %q should fail", bogus)
+	}
+}
+
+func TestPromotionSpaceImpact(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a snapshot and clone it
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	clone, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: snap.Name})
+	if err != nil {
+		t.Errorf("failed to create new clone of %q, received %+v", snap.Name, err)
+	}
+
+	if impact, err := z.PromotionSpaceImpact(clone.Name); err != nil || impact < 0 {
+		t.Errorf("unable to estimate promotion of %q, found %d, received %+v", clone.Name, impact, err)
+	} else {
+		t.Logf("promoting %s would charge %d bytes", clone.Name, impact)
+	}
+
+	// not a clone case
+	if _, err := z.PromotionSpaceImpact(fs.Name); err == nil {
+		t.Errorf("estimating promotion of %q that isn't a clone should fail", fs.Name)
+	}
+}
+
+func TestPinnedSpace(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 2 snapshots, clone only the first
+	snaps := make([]Snapshot, 0)
+	for i := 0; i < 2; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q", fs.Name)
+		}
+		snaps = append(snaps, snap)
+	}
+	if _, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: snaps[0].Name}); err != nil {
+		t.Errorf("failed to create new clone of %q, received %+v", snaps[0].Name, err)
+	}
+
+	pinned, err := z.PinnedSpace()
+	if err != nil {
+		t.Errorf("unable to get pinned space on %s, received %+v", z.Name, err)
+	} else {
+		if used, ok := pinned[snaps[0].Name]; !ok {
+			t.Errorf("origin snapshot %q should be pinned", snaps[0].Name)
+		} else {
+			t.Logf("origin snapshot %s pins %d bytes", snaps[0].Name, used)
+		}
+		if _, ok := pinned[snaps[1].Name]; ok {
+			t.Errorf("snapshot %q without clones shouldn't be pinned", snaps[1].Name)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// independent case
+	if kind, err := z.Classify(fs.Name); err != nil || kind != KindIndependent {
+		t.Errorf("filesystem %q is %s, expected %s, received %+v", fs.Name, kind, KindIndependent, err)
+	}
+
+	// create a snapshot and clone it
+	snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", fs.Name)
+	}
+	clone, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: snap.Name})
+	if err != nil {
+		t.Errorf("failed to create new clone of %q, received %+v", snap.Name, err)
+	}
+
+	// origin and clone cases
+	if kind, err := z.Classify(fs.Name); err != nil || kind != KindOrigin {
+		t.Errorf("filesystem %q is %s, expected %s, received %+v", fs.Name, kind, KindOrigin, err)
+	}
+	if kind, err := z.Classify(clone.Name); err != nil || kind != KindClone {
+		t.Errorf("filesystem %q is %s, expected %s, received %+v", clone.Name, kind, KindClone, err)
+	}
+
+	// clone that is also an origin case
+	cloneSnap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%s", clone.Name, uuid.New()))
+	if err != nil {
+		t.Errorf("failed to create new snapshot on %q", clone.Name)
+	}
+	if _, err := z.CreateFilesystem(Filesystem{Name: fmt.Sprintf("%s/new_clonefs_%s", z.Name, uuid.New()), Origin: cloneSnap.Name}); err != nil {
+		t.Errorf("failed to create new clone of %q, received %+v", cloneSnap.Name, err)
+	}
+	if kind, err := z.Classify(clone.Name); err != nil || kind != KindClone|KindOrigin {
+		t.Errorf("filesystem %q is %s, expected %s, received %+v", clone.Name, kind, KindClone|KindOrigin, err)
+	}
+}
+
+func TestDestroyFilesystem(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// working case
+	if err := z.DestroyFilesystem(fs.Name); err != nil {
+		t.Errorf("failed to destroy filesystem %q, received %+v", fs.Name, err)
+	} else if exists, _ := z.ExistsByName(fs.Name); exists {
+		t.Errorf("filesystem %q still exists after destroy", fs.Name)
+	}
+
+	// root filesystem case
+	if err := z.DestroyFilesystem(z.Name); errors.Cause(err) != ErrCannotDestroyRoot {
+		t.Errorf("destroying root filesystem %q should fail with %v, received %+v", z.Name, ErrCannotDestroyRoot, err)
+	}
+}
+
+func TestDestroySnapshotRange(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a few snapshots
+	snapshots := make([]Snapshot, 0)
+	for i := 0; i < 4; i++ {
+		snap, err := z.CreateSnapshot(fmt.Sprintf("%s@new_snap_%d_%s", fs.Name, i, uuid.New()))
+		if err != nil {
+			t.Errorf("failed to create new snapshot on %q, received %+v", fs.Name, err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	// reversed range case
+	if err := z.DestroySnapshotRange(fs.Name, snapshots[2].ShortName(), snapshots[1].ShortName()); err == nil {
+		t.Errorf("destroying a reversed range should fail")
+	}
+
+	// destroy the middle snapshots, mixing short and full names
+	if err := z.DestroySnapshotRange(fs.Name, snapshots[1].ShortName(), snapshots[2].Name); err != nil {
+		t.Errorf("failed to destroy snapshot range on %q, received %+v", fs.Name, err)
+	}
+	for i, snap := range snapshots {
+		if exists := z.SnapshotExists(snap.Name); exists != (i == 0 || i == 3) {
+			t.Errorf("snapshot %q exists: %t after destroying the range", snap.Name, exists)
+		}
+	}
+
+	// missing endpoint case
+	if err := z.DestroySnapshotRange(fs.Name, snapshots[0].ShortName(), "bogus"); err == nil {
+		t.Errorf("destroying a range with a missing endpoint should fail")
+	}
+}
+
+func TestReclaimableSpace(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 3 snapshots on new filesystem
+	names := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+		if _, err = z.CreateSnapshot(snapName); err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+		names = append(names, snapName)
+	}
+
+	// working case
+	size, err := z.ReclaimableSpace(names)
+	if err != nil {
+		t.Errorf("unable to get reclaimable space of %v, received %+v", names, err)
+	} else {
+		t.Logf("destroying %d snapshots on %s would reclaim %d bytes", len(names), fs.Name, size)
+	}
+
+	// snapshots across filesystems case
+	other := fmt.Sprintf("%s@new_snap_%s", z.Name, uuid.New())
+	if _, err := z.ReclaimableSpace(append(names, other)); err == nil {
+		t.Errorf("reclaimable space across filesystems should fail")
+	}
+
+	// empty case
+	if _, err := z.ReclaimableSpace(nil); err == nil {
+		t.Errorf("reclaimable space of no snapshots should fail")
+	}
+}
+
+func TestCreateSnapshots(t *testing.T) {
+	needsZpool(t)
+
+	// create 3 new filesystems
+	names := make([]string, 0)
+	snapLabel := fmt.Sprintf("new_snap_%s", uuid.New())
+	for i := 0; i < 3; i++ {
+		fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+		fs, err := z.CreateFilesystem(fs)
+		if err != nil {
+			t.Errorf("failed to create new filesystem %q", fs.Name)
+		}
+		names = append(names, fmt.Sprintf("%s@%s", fs.Name, snapLabel))
+	}
+
+	// snapshots should share a createtxg
+	l, err := z.CreateSnapshots(names)
+	if err != nil {
+		t.Errorf("failed to create snapshots %v, received %+v", names, err)
+	} else {
+		for _, snap := range l {
+			t.Logf("created new snapshot %s, guid: %s, createtxg: %d\n", snap.Name, snap.GUID, snap.CreateTxg)
+			if snap.CreateTxg != l[0].CreateTxg {
+				t.Errorf("snapshot %q createtxg %d differs from %d", snap.Name, snap.CreateTxg, l[0].CreateTxg)
+			}
+		}
+	}
+
+	// already existing snapshots case
+	if _, err := z.CreateSnapshots(names); err == nil {
+		t.Errorf("creating existing snapshots %v should fail", names)
+	}
+
+	// bad name case
+	if _, err := z.CreateSnapshots([]string{fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}); err == nil {
+		t.Errorf("creating snapshot without @ should fail")
+	}
+}
+
+func TestOriginSnapshot(t *testing.T) {
+
+	// clone case
+	{
+		fs := Filesystem{Name: "tank/clone", Origin: "tank/a@snap"}
+		origin, ok := fs.OriginSnapshot()
+		if !ok || origin.Name != "tank/a@snap" {
+			t.Errorf("filesystem %q should have origin snapshot %q, found %q", fs.Name, fs.Origin, origin.Name)
+		}
+	}
+
+	// not a clone cases
+	for _, o := range []string{"", "-", "tank/a", "tank/a@", "@snap"} {
+		fs := Filesystem{Name: "tank/a", Origin: o}
+		if _, ok := fs.OriginSnapshot(); ok {
+			t.Errorf("origin %q should not be parsed as a snapshot", o)
+		}
+	}
+}
+
+func TestSinceTxg(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	snap, err := z.CreateSnapshot(snapName)
+	if err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// the new filesystem is created after the txg just before it
+	filesystems, err := z.FilesystemsSinceTxg(fs.CreateTxg - 1)
+	if err != nil {
+		t.Errorf("unable to get filesystems since txg %d, received %+v", fs.CreateTxg-1, err)
+	} else if len(filesystems) == 0 {
+		t.Errorf("filesystem %q should be created since txg %d", fs.Name, fs.CreateTxg-1)
+	}
+
+	// no snapshots are created after the new snapshot
+	snapshots, err := z.SnapshotsSinceTxg(snap.CreateTxg)
+	if err != nil {
+		t.Errorf("unable to get snapshots since txg %d, received %+v", snap.CreateTxg, err)
+	} else {
+		for _, s := range snapshots {
+			if s.Name == snap.Name {
+				t.Errorf("snapshot %q should not be created since its own txg %d", snap.Name, snap.CreateTxg)
+			}
+		}
+	}
+}
+
+func TestSnapshotExists(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	if _, err = z.CreateSnapshot(snapName); err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	// working case
+	if exists := z.SnapshotExists(snapName); !exists {
+		t.Errorf("snapshot %q doesn't exist", snapName)
+	}
+
+	// filesystem name case
+	if exists := z.SnapshotExists(fs.Name); exists {
+		t.Errorf("filesystem %q should not exist as a snapshot", fs.Name)
+	}
+
+	// bogus snapshot case
+	{
+		name := fmt.Sprintf("%s@bogus", fs.Name)
+		if exists := z.SnapshotExists(name); exists {
+			t.Errorf("snapshot %q should not exist", name)
+		}
+	}
+}
+
+func TestFindSnapshots(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create 2 auto and 1 manual snapshots on new filesystem
+	for _, label := range []string{"auto", "auto", "manual"} {
+		snapName := fmt.Sprintf("%s@%s-%s", fs.Name, label, uuid.New())
+		if _, err = z.CreateSnapshot(snapName); err != nil {
+			t.Errorf("failed to create new snapshot %q", snapName)
+		}
+	}
+
+	// prefix and glob cases
+	for pattern, count := range map[string]int{"auto-": 2, "manual-*": 1, "*": 3, "bogus-": 0} {
+		l, err := z.FindSnapshots(fs.Name, pattern)
+		if err != nil {
+			t.Errorf("unable to find snapshots of %q matching %q, received %+v", fs.Name, pattern, err)
+		} else if len(l) != count {
+			t.Errorf("found %d snapshots of %q matching %q, expected %d", len(l), fs.Name, pattern, count)
+		}
+	}
+
+	// bad pattern case
+	if _, err := z.FindSnapshots(fs.Name, "["); err == nil {
+		t.Errorf("bad pattern should fail")
+	}
+}
+
+func TestParent(t *testing.T) {
+	for name, parent := range map[string]string{"tank": "", "tank/a": "tank", "tank/a/b": "tank/a"} {
+		fs := Filesystem{Name: name}
+		if p := fs.Parent(); p != parent {
+			t.Errorf("parent of %q is %q, expected %q", name, p, parent)
+		}
+	}
+}
+
+func TestChildren(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a child with a grandchild
+	child := Filesystem{Name: fmt.Sprintf("%s/child", fs.Name)}
+	if child, err = z.CreateFilesystem(child); err != nil {
+		t.Errorf("failed to create new filesystem %q", child.Name)
+	}
+	grandchild := Filesystem{Name: fmt.Sprintf("%s/grandchild", child.Name)}
+	if grandchild, err = z.CreateFilesystem(grandchild); err != nil {
+		t.Errorf("failed to create new filesystem %q", grandchild.Name)
+	}
+
+	// only the immediate child should be returned
+	l, err := z.Children(fs.Name)
+	if err != nil {
+		t.Errorf("unable to get children of %q, received %+v", fs.Name, err)
+	} else if len(l) != 1 || l[0].Name != child.Name {
+		t.Errorf("expected only child %q of %q, found %d children", child.Name, fs.Name, len(l))
+	}
+
+	// bogus name case
+	if _, err := z.Children("bogus/bogus"); err == nil {
+		t.Errorf("children of bogus filesystem should fail")
+	}
+}
+
+func TestListAll(t *testing.T) {
+	needsZpool(t)
+
+	filesystems, volumes, snapshots, err := z.ListAll()
+	if err != nil {
+		t.Errorf("unable to list datasets on %s, received %+v", z.Name, err)
+		return
+	}
+	t.Logf("found %d filesystems, %d volumes, %d snapshots on %s\n", len(filesystems), len(volumes), len(snapshots), z.Name)
+
+	// zpool root filesystem is always present
+	if _, ok := filesystems[z.Name]; !ok {
+		t.Errorf("filesystem %q not found", z.Name)
+	}
+
+	// snapshots should match a separate listing
+	l, err := z.ListSnapshots()
+	if err != nil {
+		t.Errorf("unable to get snapshots on %s, received %+v", z.Name, err)
+	}
+	for name, snap := range snapshots {
+		if s, ok := l[name]; ok && s.GUID != snap.GUID {
+			t.Errorf("snapshot %q has guid %q, expected %q", name, snap.GUID, s.GUID)
+		}
+	}
+}
+
+func TestCreateFilesystemWithParents(t *testing.T) {
+	needsZpool(t)
+
+	// parent path doesn't exist
+	name := fmt.Sprintf("%s/new_fs_%s/a/b", z.Name, uuid.New())
+
+	// without parents case
+	if _, err := z.CreateFilesystem(Filesystem{Name: name}); err == nil {
+		t.Errorf("creating %q without parents should fail", name)
+	}
+
+	// with parents case
+	fs, err := z.CreateFilesystemWithParents(Filesystem{Name: name})
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q with parents, received %+v", name, err)
+	} else {
+		t.Logf("created new filesystem %s, guid: %s, origin: %s, createtxg: %d\n", fs.Name, fs.GUID, fs.Origin, fs.CreateTxg)
+		if fs.Name != name {
+			t.Errorf("created filesystem %q, expected %q", fs.Name, name)
+		}
+	}
+}
+
+func TestListFilesystemsSorted(t *testing.T) {
+	needsZpool(t)
+
+	// sorted by createtxg descending
+	l, err := z.ListFilesystemsSorted("createtxg", true)
+	if err != nil {
+		t.Errorf("unable to get sorted filesystems on %s, received %+v", z.Name, err)
+	} else {
+		for i := 1; i < len(l); i++ {
+			if l[i-1].CreateTxg < l[i].CreateTxg {
+				t.Errorf("filesystem %q with createtxg %d sorted before %q with createtxg %d", l[i-1].Name, l[i-1].CreateTxg, l[i].Name, l[i].CreateTxg)
+			}
+		}
+	}
+
+	// unknown property case
+	if _, err := z.ListFilesystemsSorted("bogus", false); err == nil {
+		t.Errorf("sorting by bogus property should fail")
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// create a snapshot on the new filesystem
+	snapName := fmt.Sprintf("%s@new_snap_%s", fs.Name, uuid.New())
+	if _, err = z.CreateSnapshot(snapName); err != nil {
+		t.Errorf("failed to create new snapshot %q", snapName)
+	}
+
+	for name, expected := range map[string]string{fs.Name: "filesystem", snapName: "snapshot"} {
+		if typ, err := z.TypeOf(name); err != nil || typ != expected {
+			t.Errorf("dataset %q has type %q, expected %q, received %+v", name, typ, expected, err)
+		}
+	}
+
+	// bogus name case
+	if _, err := z.TypeOf(fmt.Sprintf("%s/bogus_%s", z.Name, uuid.New())); err == nil {
+		t.Errorf("type of bogus dataset should fail")
+	}
+}
+
+func TestMountWithOptions(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem, it is mounted on creation
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// unmount it first
+	if _, err := execAndLog(exec.Command(zfsPath, "unmount", fs.Name)); err != nil {
+		t.Errorf("unable to unmount %q, received %+v", fs.Name, err)
+	}
+
+	// working case
+	if err := z.MountWithOptions(fs.Name, []string{"ro", "noexec"}); err != nil {
+		t.Errorf("unable to mount %q with options, received %+v", fs.Name, err)
+	}
+
+	// unknown option case
+	if err := z.MountWithOptions(fs.Name, []string{"bogus"}); err == nil {
+		t.Errorf("mount with bogus option should fail")
+	}
+}
+
+func TestSnapshotNameParts(t *testing.T) {
+	for name, parts := range map[string][2]string{
+		"tank/a@snap": {"tank/a", "snap"},
+		"tank@snap":   {"tank", "snap"},
+		"tank/a":      {"tank/a", ""},
+	} {
+		snap := Snapshot{Name: name}
+		if fs := snap.Filesystem(); fs != parts[0] {
+			t.Errorf("filesystem of %q is %q, expected %q", name, fs, parts[0])
+		}
+		if short := snap.ShortName(); short != parts[1] {
+			t.Errorf("short name of %q is %q, expected %q", name, short, parts[1])
+		}
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// zpool root filesystem is always listed
+	filesystems, err := z.ListFilesystems()
+	if err != nil {
+		t.Errorf("unable to get filesystems on %s, received %+v", z.Name, err)
+	} else if _, ok := filesystems[z.Name]; !ok {
+		t.Errorf("filesystem %q not found in listing", z.Name)
+	}
+
+	// snapshot listing is never nil
+	snapshots, err := z.ListSnapshots()
+	if err != nil {
+		t.Errorf("unable to get snapshots on %s, received %+v", z.Name, err)
+	} else if snapshots == nil {
+		t.Errorf("snapshots on %s should be an empty map, not nil", z.Name)
+	}
+
+	// create a new filesystem without snapshots or children
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+
+	// zero snapshot case
+	if l, err := z.SnapshotsOf(fs); err != nil || l == nil || len(l) != 0 {
+		t.Errorf("filesystem %q should have an empty snapshot list, found %v, received %+v", fs.Name, l, err)
+	}
+
+	// single dataset case
+	if l, err := z.Children(fs.Name); err != nil || l == nil || len(l) != 0 {
+		t.Errorf("filesystem %q should have an empty children list, found %v, received %+v", fs.Name, l, err)
+	}
+}
+
+func TestSnapshotFilesystems(t *testing.T) {
+	needsZpool(t)
+
+	// create 2 new filesystems
+	names := make([]string, 0)
+	for i := 0; i < 2; i++ {
+		fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+		fs, err := z.CreateFilesystem(fs)
+		if err != nil {
+			t.Errorf("failed to create new filesystem %q", fs.Name)
+		}
+		names = append(names, fs.Name)
+	}
+
+	// working case
+	suffix := fmt.Sprintf("auto-%s", uuid.New())
+	l, err := z.SnapshotFilesystems(names, suffix)
+	if err != nil {
+		t.Errorf("unable to snapshot %v with suffix %q, received %+v", names, suffix, err)
+	} else if len(l) != len(names) {
+		t.Errorf("created %d snapshots, expected %d", len(l), len(names))
+	}
+
+	// bad suffix cases
+	for _, bad := range []string{"", "a@b", "a/b"} {
+		if _, err := z.SnapshotFilesystems(names, bad); err == nil {
+			t.Errorf("snapshot suffix %q should fail", bad)
+		}
+	}
+}
+
+func TestGetFilesystemProps(t *testing.T) {
+	needsZpool(t)
+
+	// get extra properties of zpool filesystem
+	fs, props, err := z.GetFilesystemProps(z.Name, "used", "available")
+	if err != nil {
+		t.Errorf("unable to get filesystem %s, received %+v", z.Name, err)
+	} else {
+		t.Logf("found filesystem %s, guid: %s, used: %s, available: %s\n", fs.Name, fs.GUID, props["used"], props["available"])
+		if fs.Name != z.Name || len(props["used"]) == 0 || len(props["available"]) == 0 {
+			t.Errorf("filesystem %q is missing extra properties, found %v", z.Name, props)
+		}
+	}
+
+	// no extra properties case
+	if _, props, err := z.GetFilesystemProps(z.Name); err != nil || len(props) != 0 {
+		t.Errorf("filesystem %q should have no extra properties, found %v, received %+v", z.Name, props, err)
+	}
+
+	// bad property names case
+	for _, property := range []string{"", "used,available", "used available", "used\t"} {
+		if _, _, err := z.GetFilesystemProps(z.Name, property); err == nil {
+			t.Errorf("getting property %q of filesystem %q should fail", property, z.Name)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+
+	// unset values parse as zero
+	for _, value := range []string{"-", ""} {
+		if p, err := parseInt("used", value); err != nil || p != 0 {
+			t.Errorf("value %q should parse to 0, found %d, received %+v", value, p, err)
+		}
+	}
+
+	// a dataset with an unset createtxg doesn't fail
+	var snap Snapshot
+	if err := snap.setProperty("createtxg", "-"); err != nil {
+		t.Errorf("unset createtxg should not fail, received %+v", err)
+	}
+
+	// numeric and bogus values
+	if p, err := parseInt("used", "1024"); err != nil || p != 1024 {
+		t.Errorf("value %q should parse to 1024, found %d, received %+v", "1024", p, err)
+	}
+	if _, err := parseInt("used", "bogus"); err == nil {
+		t.Errorf("value %q should fail to parse", "bogus")
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+
+	cases := map[string]float64{"1.50x": 1.5, "1.00": 1, "12.34x": 12.34, "-": 0, "": 0}
+	for value, expected := range cases {
+		if r, err := parseRatio("compressratio", value); err != nil || r != expected {
+			t.Errorf("value %q should parse to %v, found %v, received %+v", value, expected, r, err)
+		}
+	}
+
+	// bogus values
+	for _, value := range []string{"x", "1.5y", "-1.5x", "bogus"} {
+		if _, err := parseRatio("compressratio", value); err == nil {
+			t.Errorf("value %q should fail to parse", value)
+		}
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+
+	// trailing newlines and CRLF line endings
+	out := []byte("tank\tguid\t1234\r\ntank\tcreatetxg\t1\r\n\r\ntank/a\tguid\t5678\r\n\n\n")
+
+	props, names, err := parseProperties(out)
+	if err != nil {
+		t.Errorf("unable to parse properties, received %+v", err)
+	}
+	if len(names) != 2 || len(props) != 2 {
+		t.Errorf("expected datasets [tank tank/a], found %v", names)
+	}
+	if _, ok := props[""]; ok {
+		t.Errorf("phantom dataset with empty name found")
+	}
+	if props["tank"]["guid"] != "1234" || props["tank"]["createtxg"] != "1" || props["tank/a"]["guid"] != "5678" {
+		t.Errorf("unexpected properties, found %v", props)
+	}
+
+	// values with spaces are kept whole
+	if props, _, err := parseProperties([]byte("tank@a\tuser:comment\tbefore DB migration\n")); err != nil || props["tank@a"]["user:comment"] != "before DB migration" {
+		t.Errorf("unexpected properties, found %v, received %+v", props, err)
+	}
+
+	// lines with missing or extra columns fail with the offending line
+	for _, line := range []string{"tank\tguid", "tank\tguid\t1234\tlocal", "tank guid 1234", "\tguid\t1234"} {
+		if _, _, err := parseProperties([]byte(line + "\n")); err == nil {
+			t.Errorf("parsing line %q should fail", line)
+		} else if !strings.Contains(err.Error(), fmt.Sprintf("%q", line)) {
+			t.Errorf("error of line %q should name the line, received %+v", line, err)
+		}
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+
+	// a trailing carriage return is trimmed
+	if fields, err := splitFields("guid\t1234\r", 2); err != nil || fields[0] != "guid" || fields[1] != "1234" {
+		t.Errorf("unexpected fields %q, received %+v", fields, err)
+	}
+
+	// shifted columns
+	for _, line := range []string{"guid", "guid\t1234\tlocal", ""} {
+		if _, err := splitFields(line, 2); err == nil {
+			t.Errorf("splitting line %q into 2 fields should fail", line)
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+
+	pool := Zpool{Name: "tank"}
+	for name, owned := range map[string]bool{
+		"tank":         true,
+		"tank/a":       true,
+		"tank@snap":    true,
+		"tank/a@snap":  true,
+		"tank/a#mark":  true,
+		"tank2":        false,
+		"tank2/a":      false,
+		"tank2@snap":   false,
+		"bogus/tank/a": false,
+		"":             false,
+	} {
+		if ok := pool.owns(name); ok != owned {
+			t.Errorf("zpool %q owns %q is %t, expected %t", pool.Name, name, ok, owned)
+		}
+	}
+}
+
+func TestUsedBy(t *testing.T) {
+	needsZpool(t)
+
+	var err error
+
+	// create a new filesystem with a child
+	fs := Filesystem{Name: fmt.Sprintf("%s/new_fs_%s", z.Name, uuid.New())}
+	fs, err = z.CreateFilesystem(fs)
+	if err != nil {
+		t.Errorf("failed to create new filesystem %q", fs.Name)
+	}
+	child := Filesystem{Name: fmt.Sprintf("%s/child", fs.Name)}
+	if _, err = z.CreateFilesystem(child); err != nil {
+		t.Errorf("failed to create new filesystem %q", child.Name)
+	}
+
+	// the child's space is charged to its parent
+	fs, err = z.GetFilesystem(fs.Name)
+	if err != nil {
+		t.Errorf("unable to get filesystem %q, received %+v", fs.Name, err)
+	} else {
+		t.Logf("found filesystem %s, usedbysnapshots: %d, usedbydataset: %d, usedbychildren: %d, usedbyrefreservation: %d\n", fs.Name, fs.UsedBySnapshots, fs.UsedByDataset, fs.UsedByChildren, fs.UsedByRefReservation)
+		if fs.UsedByDataset == 0 || fs.UsedByChildren == 0 {
+			t.Errorf("filesystem %q should use space by dataset and children", fs.Name)
+		}
+	}
+}
+
+func TestSortedByCreateTxg(t *testing.T) {
+
+	// b has no createtxg and is ordered by its creation time between a and c
+	l := Snapshots{
+		"tank@c": {Name: "tank@c", CreateTxg: 30, Creation: time.Unix(300, 0)},
+		"tank@a": {Name: "tank@a", CreateTxg: 10, Creation: time.Unix(100, 0)},
+		"tank@b": {Name: "tank@b", Creation: time.Unix(200, 0)},
+	}
+	names := make([]string, 0)
+	for _, snap := range l.SortedByCreateTxg() {
+		names = append(names, snap.Name)
+	}
+	if strings.Join(names, ",") != "tank@a,tank@b,tank@c" {
+		t.Errorf("snapshots should be ordered a, b, c, found %v", names)
+	}
+
+	// the createtxg orders every snapshot when all have one, even against their creation time
+	withTxg := []*Snapshot{
+		{Name: "tank@c", CreateTxg: 30, Creation: time.Unix(100, 0)},
+		{Name: "tank@a", CreateTxg: 10, Creation: time.Unix(300, 0)},
+		{Name: "tank@b", CreateTxg: 20, Creation: time.Unix(200, 0)},
+	}
+	sortByCreateTxg(withTxg)
+	if withTxg[0].Name != "tank@a" || withTxg[1].Name != "tank@b" || withTxg[2].Name != "tank@c" {
+		t.Errorf("snapshots with createtxg should be ordered a, b, c, found %s, %s, %s", withTxg[0].Name, withTxg[1].Name, withTxg[2].Name)
+	}
+
+	// one snapshot without createtxg orders all of them by creation time
+	withTxg = append(withTxg, &Snapshot{Name: "tank@d", Creation: time.Unix(150, 0)})
+	sortByCreateTxg(withTxg)
+	names = make([]string, 0)
+	for _, snap := range withTxg {
+		names = append(names, snap.Name)
+	}
+	if strings.Join(names, ",") != "tank@c,tank@d,tank@b,tank@a" {
+		t.Errorf("snapshots should be ordered c, d, b, a by creation time, found %v", names)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	needsZpool(t)
+
+	// the tests run on a host with zfs, so the checks passed
+	r := Preflight()
+	if !r.OK || len(r.Error) > 0 {
+		t.Errorf("preflight should succeed, received %q", r.Error)
+	}
+	if len(r.ZFSVersion) == 0 || len(r.ZpoolVersion) == 0 {
+		t.Errorf("preflight should capture versions, found %+v", r)
+	}
+	t.Logf("preflight result %+v", r)
+}